@@ -0,0 +1,162 @@
+package peekbuffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrVarintOverflow is returned by PeekVarint and ReadVarint when a varint is longer than binary.MaxVarintLen64
+// bytes or its value does not fit in 64 bits.
+var ErrVarintOverflow = errors.New("peekbuffer: varint overflows a 64-bit integer")
+
+// PeekUint16 decodes the next 2 bytes of the stream as an unsigned integer in the given byte order,
+// without consuming them.
+//
+// Parameters:
+//   - order binary.ByteOrder: The byte order of the integer, such as binary.BigEndian.
+//
+// Returns:
+//   - uint16: The decoded integer.
+//   - error: As for PeekFull: io.EOF if the stream is empty, io.ErrUnexpectedEOF if it ends early, or any other error.
+func (this *PeekBuffer) PeekUint16(order binary.ByteOrder) (uint16, error) {
+	peeked, err := this.PeekFull(2)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint16(peeked), nil
+}
+
+// PeekUint32 decodes the next 4 bytes of the stream as an unsigned integer in the given byte order,
+// without consuming them.
+//
+// Parameters:
+//   - order binary.ByteOrder: The byte order of the integer, such as binary.BigEndian.
+//
+// Returns:
+//   - uint32: The decoded integer.
+//   - error: As for PeekFull: io.EOF if the stream is empty, io.ErrUnexpectedEOF if it ends early, or any other error.
+func (this *PeekBuffer) PeekUint32(order binary.ByteOrder) (uint32, error) {
+	peeked, err := this.PeekFull(4)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint32(peeked), nil
+}
+
+// PeekUint64 decodes the next 8 bytes of the stream as an unsigned integer in the given byte order,
+// without consuming them.
+//
+// Parameters:
+//   - order binary.ByteOrder: The byte order of the integer, such as binary.BigEndian.
+//
+// Returns:
+//   - uint64: The decoded integer.
+//   - error: As for PeekFull: io.EOF if the stream is empty, io.ErrUnexpectedEOF if it ends early, or any other error.
+func (this *PeekBuffer) PeekUint64(order binary.ByteOrder) (uint64, error) {
+	peeked, err := this.PeekFull(8)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint64(peeked), nil
+}
+
+// ReadUint16 reads the next 2 bytes of the stream as an unsigned integer in the given byte order.
+// Nothing is consumed if an error is returned.
+//
+// Parameters:
+//   - order binary.ByteOrder: The byte order of the integer, such as binary.BigEndian.
+//
+// Returns:
+//   - uint16: The decoded integer.
+//   - error: Any error returned by PeekUint16.
+func (this *PeekBuffer) ReadUint16(order binary.ByteOrder) (uint16, error) {
+	v, err := this.PeekUint16(order)
+	if err == nil {
+		this.advance(2)
+	}
+	return v, err
+}
+
+// ReadUint32 reads the next 4 bytes of the stream as an unsigned integer in the given byte order.
+// Nothing is consumed if an error is returned.
+//
+// Parameters:
+//   - order binary.ByteOrder: The byte order of the integer, such as binary.BigEndian.
+//
+// Returns:
+//   - uint32: The decoded integer.
+//   - error: Any error returned by PeekUint32.
+func (this *PeekBuffer) ReadUint32(order binary.ByteOrder) (uint32, error) {
+	v, err := this.PeekUint32(order)
+	if err == nil {
+		this.advance(4)
+	}
+	return v, err
+}
+
+// ReadUint64 reads the next 8 bytes of the stream as an unsigned integer in the given byte order.
+// Nothing is consumed if an error is returned.
+//
+// Parameters:
+//   - order binary.ByteOrder: The byte order of the integer, such as binary.BigEndian.
+//
+// Returns:
+//   - uint64: The decoded integer.
+//   - error: Any error returned by PeekUint64.
+func (this *PeekBuffer) ReadUint64(order binary.ByteOrder) (uint64, error) {
+	v, err := this.PeekUint64(order)
+	if err == nil {
+		this.advance(8)
+	}
+	return v, err
+}
+
+// PeekVarint decodes an unsigned base-128 varint, as used by protobuf and encoding/binary.PutUvarint,
+// from the start of the stream without consuming it, which suits length-prefixed framing.
+// Only the bytes of the varint itself are buffered, so peeking a length prefix never blocks waiting for the payload.
+// Non-minimal encodings are accepted, as they are by binary.Uvarint.
+//
+// Returns:
+//   - value uint64: The decoded value.
+//   - n int: The number of bytes in the encoded varint.
+//   - err error: io.EOF if the stream is empty, io.ErrUnexpectedEOF if it ends within the varint,
+//     ErrVarintOverflow if the varint does not fit in 64 bits, or any error returned by Peek.
+func (this *PeekBuffer) PeekVarint() (value uint64, n int, err error) {
+	peeked := this.buffer[this.head:this.tail]
+	for {
+		if len(peeked) > binary.MaxVarintLen64 {
+			peeked = peeked[:binary.MaxVarintLen64]
+		}
+		if value, n = binary.Uvarint(peeked); n > 0 {
+			return value, n, nil
+		} else if n < 0 || len(peeked) == binary.MaxVarintLen64 {
+			return 0, 0, ErrVarintOverflow
+		}
+
+		// The varint continues past the buffered data
+		have := len(peeked)
+		if peeked, err = this.peek(have + 1); err != nil {
+			return 0, 0, err
+		}
+		if len(peeked) == have {
+			if have == 0 {
+				return 0, 0, io.EOF
+			}
+			return 0, 0, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// ReadVarint reads an unsigned base-128 varint from the stream. Nothing is consumed if an error is returned.
+//
+// Returns:
+//   - uint64: The decoded value.
+//   - error: Any error returned by PeekVarint.
+func (this *PeekBuffer) ReadVarint() (uint64, error) {
+	value, n, err := this.PeekVarint()
+	if err == nil {
+		this.advance(n)
+	}
+	return value, err
+}
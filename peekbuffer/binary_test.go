@@ -0,0 +1,130 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPeekBuffer_PeekUint(t *testing.T) {
+	input := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}
+
+	tests := []struct {
+		name  string
+		order binary.ByteOrder
+		peek  func(pb *PeekBuffer, order binary.ByteOrder) (uint64, error)
+		read  func(pb *PeekBuffer, order binary.ByteOrder) (uint64, error)
+		size  int
+		want  uint64
+	}{
+		{"Uint16 big endian", binary.BigEndian, peekUint16, readUint16, 2, 0x0102},
+		{"Uint16 little endian", binary.LittleEndian, peekUint16, readUint16, 2, 0x0201},
+		{"Uint32 big endian", binary.BigEndian, peekUint32, readUint32, 4, 0x01020304},
+		{"Uint32 little endian", binary.LittleEndian, peekUint32, readUint32, 4, 0x04030201},
+		{"Uint64 big endian", binary.BigEndian, peekUint64, readUint64, 8, 0x0102030405060708},
+		{"Uint64 little endian", binary.LittleEndian, peekUint64, readUint64, 8, 0x0807060504030201},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A fill size of 1 makes every integer span several fills
+			pb := NewPeekBufferSize(bytes.NewReader(input), 1)
+			got, err := tt.peek(pb, tt.order)
+			if err != nil || got != tt.want {
+				t.Errorf("Peek got = %#x, err %v, want %#x", got, err, tt.want)
+			}
+			got, err = tt.read(pb, tt.order)
+			if err != nil || got != tt.want {
+				t.Errorf("Read got = %#x, err %v, want %#x", got, err, tt.want)
+			}
+			if pb.Offset() != int64(tt.size) {
+				t.Errorf("Offset() got = %v, want %v", pb.Offset(), tt.size)
+			}
+
+			// Only one byte is left, so the next integer is truncated and nothing is consumed
+			pb.Discard(len(input) - 1 - tt.size)
+			if _, err := tt.read(pb, tt.order); err != io.ErrUnexpectedEOF {
+				t.Errorf("Read at the end error = %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+			pb.Discard(1)
+			if _, err := tt.peek(pb, tt.order); err != io.EOF {
+				t.Errorf("Peek at EOF error = %v, want %v", err, io.EOF)
+			}
+		})
+	}
+}
+
+func peekUint16(pb *PeekBuffer, order binary.ByteOrder) (uint64, error) {
+	v, err := pb.PeekUint16(order)
+	return uint64(v), err
+}
+
+func peekUint32(pb *PeekBuffer, order binary.ByteOrder) (uint64, error) {
+	v, err := pb.PeekUint32(order)
+	return uint64(v), err
+}
+
+func peekUint64(pb *PeekBuffer, order binary.ByteOrder) (uint64, error) {
+	return pb.PeekUint64(order)
+}
+
+func readUint16(pb *PeekBuffer, order binary.ByteOrder) (uint64, error) {
+	v, err := pb.ReadUint16(order)
+	return uint64(v), err
+}
+
+func readUint32(pb *PeekBuffer, order binary.ByteOrder) (uint64, error) {
+	v, err := pb.ReadUint32(order)
+	return uint64(v), err
+}
+
+func readUint64(pb *PeekBuffer, order binary.ByteOrder) (uint64, error) {
+	return pb.ReadUint64(order)
+}
+
+func TestPeekBuffer_PeekVarint(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    uint64
+		wantN   int
+		wantErr error
+	}{
+		{"Zero", []byte{0x00, 0xff}, 0, 1, nil},
+		{"One byte", []byte{0x7f, 0xff}, 0x7f, 1, nil},
+		{"Two bytes", []byte{0xac, 0x02, 0xff}, 300, 2, nil},
+		{"Max", binary.AppendUvarint(nil, 1<<64-1), 1<<64 - 1, 10, nil},
+		{"Non-minimal", []byte{0x81, 0x80, 0x00}, 1, 3, nil},
+		{"Truncated", []byte{0xac}, 0, 0, io.ErrUnexpectedEOF},
+		{"Empty", nil, 0, 0, io.EOF},
+		{"Overflow", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}, 0, 0, ErrVarintOverflow},
+		{"Too long", bytes.Repeat([]byte{0x80}, 11), 0, 0, ErrVarintOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A fill size of 1 makes every varint span several fills
+			pb := NewPeekBufferSize(bytes.NewReader(tt.input), 1)
+			got, n, err := pb.PeekVarint()
+			if got != tt.want || n != tt.wantN || err != tt.wantErr {
+				t.Errorf("PeekVarint() got = %v, %v, err %v, want %v, %v, err %v", got, n, err, tt.want, tt.wantN, tt.wantErr)
+			}
+			if got, err := pb.ReadVarint(); got != tt.want || err != tt.wantErr {
+				t.Errorf("ReadVarint() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != int64(tt.wantN) {
+				t.Errorf("Offset() after ReadVarint got = %v, want %v", pb.Offset(), tt.wantN)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekVarintDoesNotOverread(t *testing.T) {
+	// The payload after the length prefix has not arrived, so reading past the varint would block
+	pb := NewPeekBuffer(io.MultiReader(iotest.OneByteReader(bytes.NewReader([]byte{0xac, 0x02})), PanicReader{}))
+	if got, err := pb.ReadVarint(); got != 300 || err != nil {
+		t.Errorf("ReadVarint() got = %v, err %v, want 300", got, err)
+	}
+}
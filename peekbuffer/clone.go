@@ -0,0 +1,76 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrNotClonable is returned by Clone when the rest of the stream can't be read independently of the PeekBuffer.
+var ErrNotClonable = errors.New("peekbuffer: stream is neither fully buffered nor an io.ReaderAt and io.Seeker")
+
+// Clone returns an independent PeekBuffer at the same position in the stream, so several parse strategies can be
+// tried in parallel from one starting point. The clone has its own copy of the buffered data, and reading from
+// either PeekBuffer never affects the other.
+//
+// A clone can only continue the stream without disturbing the original when the stream has been fully buffered,
+// for example by PeekAll, or when the underlying reader is both an io.ReaderAt and an io.Seeker, such as
+// *os.File, *bytes.Reader and *strings.Reader. A reader that is only an io.Seeker is not enough, because both
+// PeekBuffers would move the same position. In the second case the clone reads the rest of the stream with
+// ReadAt from the current position of the underlying reader, which is never moved.
+//
+// The clone has the same fill size, maximum buffer size, strict EOF, greedy read, shrink, history and growth
+// settings, Offset and retained history. A remembered read error is reported by the clone once its buffered data
+// is drained. Marks, snapshots, recordings, tee and capture writers, fill hooks, deadlines and statistics are not
+// carried over.
+// Neither PeekBuffer is safe for concurrent use, but each can be used from its own goroutine, provided the
+// underlying reader allows ReadAt concurrently with Read, as *os.File and *bytes.Reader do.
+//
+// Returns:
+//   - *PeekBuffer: The clone.
+//   - error: ErrNotClonable if the stream can't be cloned, any error returned by the Seek method of the underlying
+//     reader, otherwise nil.
+func (this *PeekBuffer) Clone() (*PeekBuffer, error) {
+	if this.pending != nil {
+		// The error is remembered by collect and passed on below
+		this.collect()
+	}
+
+	var rest io.Reader
+	if this.err != nil {
+		rest = &errReader{err: this.err}
+	} else if this.eof {
+		rest = bytes.NewReader(nil)
+	} else if at, ok := this.reader.(io.ReaderAt); !ok {
+		return nil, ErrNotClonable
+	} else if seeker, ok := this.reader.(io.Seeker); !ok {
+		return nil, ErrNotClonable
+	} else {
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		rest = io.NewSectionReader(at, pos, math.MaxInt64-pos)
+	}
+
+	history := this.History()
+	clone := &PeekBuffer{
+		reader:       rest,
+		buffer:       make([]byte, len(history)+this.Buffered()),
+		head:         len(history),
+		tail:         len(history) + this.Buffered(),
+		fillSize:     this.fillSize,
+		maxSize:      this.maxSize,
+		err:          this.err,
+		eof:          this.eof,
+		offset:       this.offset,
+		strictEOF:    this.strictEOF,
+		greedyRead:   this.greedyRead,
+		shrinkBelow:  this.shrinkBelow,
+		historySize:  this.historySize,
+		growthFactor: this.growthFactor,
+	}
+	copy(clone.buffer, this.buffer[this.head-len(history):this.tail])
+	return clone, nil
+}
@@ -0,0 +1,88 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPeekBuffer_Clone(t *testing.T) {
+	input := benchmarkInput()[:10000]
+
+	tests := []struct {
+		name   string
+		reader func() io.Reader
+		setup  func(pb *PeekBuffer)
+	}{
+		{"Fully buffered", func() io.Reader { return iotest.OneByteReader(bytes.NewReader(input)) }, func(pb *PeekBuffer) {
+			pb.Discard(100)
+			pb.PeekAll()
+		}},
+		{"ReaderAt", func() io.Reader { return bytes.NewReader(input) }, func(pb *PeekBuffer) {
+			pb.Discard(100)
+			pb.Peek(10)
+		}},
+		{"ReaderAt nothing buffered", func() io.Reader { return bytes.NewReader(input) }, func(pb *PeekBuffer) {}},
+		{"ReaderAt after Unread", func() io.Reader { return bytes.NewReader(input) }, func(pb *PeekBuffer) {
+			pb.Discard(1500)
+			pb.Unread(input[1400:1500])
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := New(tt.reader(), WithFillSize(1000), WithHistory(8))
+			tt.setup(pb)
+			offset := pb.Offset()
+
+			clone, err := pb.Clone()
+			if err != nil {
+				t.Fatalf("Clone() error = %v", err)
+			}
+			if clone.Offset() != offset || !bytes.Equal(clone.History(), pb.History()) {
+				t.Errorf("Clone() Offset() = %d, History() = %v, want %d, %v", clone.Offset(), clone.History(), offset, pb.History())
+			}
+
+			// Reading the clone to the end leaves the original where it was
+			got, err := io.ReadAll(clone)
+			if err != nil || !bytes.Equal(got, input[offset:]) {
+				t.Errorf("ReadAll() of clone got %d bytes, err %v, want %d", len(got), err, len(input)-int(offset))
+			}
+			got, err = io.ReadAll(pb)
+			if err != nil || !bytes.Equal(got, input[offset:]) {
+				t.Errorf("ReadAll() of original got %d bytes, err %v, want %d", len(got), err, len(input)-int(offset))
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_CloneNotClonable(t *testing.T) {
+	pb := NewPeekBuffer(iotest.OneByteReader(bytes.NewReader([]byte("hello world"))))
+	pb.Peek(5)
+	if _, err := pb.Clone(); err != ErrNotClonable {
+		t.Errorf("Clone() error = %v, want %v", err, ErrNotClonable)
+	}
+	// The original is unaffected
+	if got, err := io.ReadAll(pb); err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v", got, err)
+	}
+}
+
+func TestPeekBuffer_CloneError(t *testing.T) {
+	readErr := errors.New("read failed")
+	pb := NewPeekBuffer(&DataErrorReader{data: []byte("hello"), err: readErr})
+	pb.Peek(5)
+	pb.Discard(1)
+
+	clone, err := pb.Clone()
+	if err != nil {
+		t.Fatalf("Clone() error = %v", err)
+	}
+	for name, pb := range map[string]*PeekBuffer{"clone": clone, "original": pb} {
+		if got, err := io.ReadAll(pb); err != readErr || string(got) != "ello" {
+			t.Errorf("ReadAll() of %s got = %q, err %v, want %q, %v", name, got, err, "ello", readErr)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package peekbuffer
+
+import (
+	"net"
+	"time"
+)
+
+// PeekConn is a net.Conn that reads through a PeekBuffer, so the start of a connection can be sniffed,
+// for example for a PROXY protocol header or a TLS ClientHello, before the connection is handed to an
+// http.Server or a TLS handshake. Reads, including peeked data, go through the embedded PeekBuffer, while
+// writes, addresses and deadlines are forwarded to the underlying connection.
+type PeekConn struct {
+	*PeekBuffer
+	conn net.Conn
+}
+
+var _ net.Conn = (*PeekConn)(nil)
+
+// NewPeekConn creates and returns a new PeekConn that wraps the provided connection.
+//
+// Parameters:
+//   - conn net.Conn: The underlying connection to wrap.
+//   - opts ...Option: Options that configure the PeekBuffer, as for New.
+//
+// Returns:
+//   - *PeekConn: A new PeekConn instance.
+func NewPeekConn(conn net.Conn, opts ...Option) *PeekConn {
+	return &PeekConn{
+		PeekBuffer: New(conn, opts...),
+		conn:       conn,
+	}
+}
+
+// Conn returns the underlying connection.
+// Data that has already been buffered is not visible through the returned connection.
+func (this *PeekConn) Conn() net.Conn {
+	return this.conn
+}
+
+// Write writes data to the underlying connection.
+func (this *PeekConn) Write(p []byte) (n int, err error) {
+	return this.conn.Write(p)
+}
+
+// Close closes the underlying connection.
+func (this *PeekConn) Close() error {
+	return this.conn.Close()
+}
+
+// LocalAddr returns the local network address of the underlying connection.
+func (this *PeekConn) LocalAddr() net.Addr {
+	return this.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address of the underlying connection.
+func (this *PeekConn) RemoteAddr() net.Addr {
+	return this.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+// The read deadline is recorded like one set by PeekBuffer.SetDeadline, so PeekContext restores it once it returns.
+func (this *PeekConn) SetDeadline(t time.Time) error {
+	if err := this.conn.SetDeadline(t); err != nil {
+		return err
+	}
+	this.deadline = t
+	return nil
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+// Reads that can be served from buffered data succeed regardless of the deadline.
+// The deadline is recorded like one set by PeekBuffer.SetDeadline, so PeekContext restores it once it returns.
+func (this *PeekConn) SetReadDeadline(t time.Time) error {
+	if err := this.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	this.deadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (this *PeekConn) SetWriteDeadline(t time.Time) error {
+	return this.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,115 @@
+package peekbuffer
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPeekConn(t *testing.T) {
+	server, client := net.Pipe()
+	pc := NewPeekConn(client)
+	defer pc.Close()
+
+	go func() {
+		server.Write([]byte("hello world"))
+		buf := make([]byte, 5)
+		io.ReadFull(server, buf)
+		server.Write(buf)
+		server.Close()
+	}()
+
+	peeked, err := pc.Peek(5)
+	if err != nil || string(peeked) != "hello" {
+		t.Errorf("Peek() got = %q, err %v, want %q", string(peeked), err, "hello")
+	}
+	buf := make([]byte, 11)
+	if _, err := io.ReadFull(pc, buf); err != nil || string(buf) != "hello world" {
+		t.Errorf("ReadFull() got = %q, err %v, want %q", string(buf), err, "hello world")
+	}
+
+	if _, err := pc.Write([]byte("reply")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got, err := io.ReadAll(pc)
+	if err != nil || string(got) != "reply" {
+		t.Errorf("ReadAll() got = %q, err %v, want %q", string(got), err, "reply")
+	}
+
+	if pc.LocalAddr() != client.LocalAddr() || pc.RemoteAddr() != client.RemoteAddr() {
+		t.Error("PeekConn did not forward addresses")
+	}
+	if pc.Conn() != client {
+		t.Error("Conn() did not return the underlying connection")
+	}
+}
+
+func TestPeekConn_Deadlines(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	pc := NewPeekConn(client)
+	defer pc.Close()
+
+	if err := pc.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline() error = %v", err)
+	}
+	if _, err := pc.Peek(1); !os.IsTimeout(err) {
+		t.Errorf("Peek() error = %v, want a timeout", err)
+	}
+
+	if err := pc.SetWriteDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetWriteDeadline() error = %v", err)
+	}
+	if _, err := pc.Write([]byte("x")); !os.IsTimeout(err) {
+		t.Errorf("Write() error = %v, want a timeout", err)
+	}
+
+	if err := pc.SetDeadline(time.Time{}); err != nil {
+		t.Fatalf("SetDeadline() error = %v", err)
+	}
+	go server.Write([]byte("ok"))
+	if peeked, err := pc.Peek(2); err != nil || string(peeked) != "ok" {
+		t.Errorf("Peek() after clearing deadline got = %q, err %v", string(peeked), err)
+	}
+}
+
+func TestPeekConn_DeadlineAfterPeekContext(t *testing.T) {
+	for _, name := range []string{"SetReadDeadline", "SetDeadline"} {
+		t.Run(name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			pc := NewPeekConn(client)
+			defer pc.Close()
+
+			deadline := time.Now().Add(50 * time.Millisecond)
+			if name == "SetReadDeadline" {
+				pc.SetReadDeadline(deadline)
+			} else {
+				pc.SetDeadline(deadline)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			if _, err := pc.PeekContext(ctx, 1); err != context.DeadlineExceeded {
+				t.Errorf("PeekContext() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			// The deadline set on the PeekConn is still in force once PeekContext returns
+			done := make(chan error, 1)
+			go func() {
+				_, err := pc.Peek(1)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if !os.IsTimeout(err) {
+					t.Errorf("Peek() error = %v, want a timeout", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Peek() blocked past the read deadline")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package peekbuffer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// pendingRead is the result of a read from the underlying reader that PeekContext started
+// in a separate goroutine and stopped waiting for when its context was done.
+type pendingRead struct {
+	data []byte
+	err  error
+}
+
+// readDeadliner is implemented by readers such as net.Conn and *os.File that support read deadlines.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// PeekContext is like Peek but gives up waiting for the underlying reader once ctx is done.
+// If the underlying reader supports read deadlines, such as a net.Conn, the deadline is set from ctx, or from
+// SetDeadline if that is earlier, and moved into the past when ctx is cancelled. Before PeekContext returns the
+// deadline is restored to the one set by SetDeadline, or cleared if there is none. This overrides any read deadline
+// set on the reader directly by the caller.
+// Otherwise each read runs in a separate goroutine. A read that is still blocked when ctx is done is
+// left in flight and its result is buffered by the next operation that needs data from the underlying
+// reader, so no data is lost and the goroutine exits as soon as the underlying read returns.
+// The returned slice is only valid until the next Read operation.
+//
+// Parameters:
+//   - ctx context.Context: The context that bounds how long PeekContext waits for data.
+//   - size int: The number of bytes to peek ahead.
+//
+// Returns:
+//   - []byte: A slice containing the peeked data. May be shorter than 'size' if ctx was done or the wrapped
+//     stream has less data than requested.
+//   - error: ctx.Err() if ctx was done before enough data arrived, otherwise as for Peek, including WithStrictEOF.
+func (this *PeekBuffer) PeekContext(ctx context.Context, size int) ([]byte, error) {
+	peeked, err := this.peekContext(ctx, size)
+	if this.strictEOF {
+		err = truncated(peeked, size, err)
+	}
+	return peeked, err
+}
+
+// peekContext implements PeekContext without WithStrictEOF.
+func (this *PeekBuffer) peekContext(ctx context.Context, size int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return this.peeked(0, err)
+	}
+	if this.err != nil || this.Buffered() >= this.peekLimit(size) {
+		return this.peek(size)
+	}
+
+	if deadliner, ok := this.reader.(readDeadliner); ok && this.pending == nil {
+		return this.peekDeadline(ctx, deadliner, size)
+	}
+
+	var err error
+	for err == nil && this.Buffered() < this.peekLimit(size) {
+		if this.pending == nil {
+			this.startRead(this.peekLimit(size) - this.Buffered())
+		}
+		select {
+		case result := <-this.pending:
+			this.pending = nil
+			// Like fill, stop at an error even if data arrived with it, so the stream is not read past it
+			this.appendRead(result)
+			err = result.err
+		case <-ctx.Done():
+			return this.peeked(size, ctx.Err())
+		}
+	}
+	return this.peeked(size, err)
+}
+
+// peekDeadline implements PeekContext for readers that support read deadlines.
+func (this *PeekBuffer) peekDeadline(ctx context.Context, deadliner readDeadliner, size int) ([]byte, error) {
+	// The deadline set by SetDeadline must not override the one from ctx while peeking
+	saved := this.deadline
+	this.deadline = time.Time{}
+	defer func() { this.deadline = saved }()
+
+	deadline, ok := ctx.Deadline()
+	if !saved.IsZero() && (!ok || saved.Before(deadline)) {
+		deadline = saved
+	}
+	if err := deadliner.SetReadDeadline(deadline); err != nil {
+		return this.peeked(0, err)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			// Unblock the pending read
+			deadliner.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	peeked, err := this.peek(size)
+
+	close(stop)
+	wg.Wait()
+	deadliner.SetReadDeadline(saved)
+
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return peeked, err
+}
+
+// startRead reads up to size bytes, but at most fillSize, from the underlying reader in a separate goroutine.
+// The result is delivered on a buffered channel so the goroutine never blocks, even if nobody collects it.
+func (this *PeekBuffer) startRead(size int) {
+	if size > this.fillSize {
+		size = this.fillSize
+	}
+	reader := this.reader
+	pending := make(chan pendingRead, 1)
+	this.pending = pending
+	go func() {
+		data := make([]byte, size)
+		n, err := reader.Read(data)
+		pending <- pendingRead{data: data[:n], err: err}
+	}()
+}
+
+// collect waits for the read left in flight by PeekContext and buffers its result.
+//
+// Returns:
+//   - error: The error returned by the read if it returned no data, otherwise nil.
+func (this *PeekBuffer) collect() error {
+	result := <-this.pending
+	this.pending = nil
+	return this.appendRead(result)
+}
+
+// awaitPending waits for the read left in flight by PeekContext, if there is one, and buffers its result.
+// The read is only waited for once the buffered data has run out, so buffered data is never held up by it.
+//
+// Returns:
+//   - error: The error returned by the read if it returned no data, otherwise nil.
+func (this *PeekBuffer) awaitPending() error {
+	if this.pending == nil || this.head < this.tail {
+		return nil
+	}
+	return this.collect()
+}
+
+// appendRead appends the data of a completed read to the internal buffer and remembers its error.
+//
+// Returns:
+//   - error: The error returned by the read if it returned no data, otherwise nil.
+func (this *PeekBuffer) appendRead(result pendingRead) error {
+	this.reserve(len(result.data))
+	this.tail += copy(this.buffer[this.tail:], result.data)
+	this.filled(len(result.data), result.err)
+	this.setErr(result.err)
+	if len(result.data) > 0 && result.err == nil {
+		this.eof = false
+	}
+	if len(result.data) == 0 {
+		return result.err
+	}
+	return nil
+}
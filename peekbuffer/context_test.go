@@ -0,0 +1,191 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeekBuffer_PeekContext(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+
+	got, err := pb.PeekContext(context.Background(), 5)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("PeekContext() got = %q, err %v, want %q", string(got), err, "hello")
+	}
+
+	got, err = pb.PeekContext(context.Background(), 20)
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("PeekContext() got = %q, err %v, want %q", string(got), err, "hello world")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = pb.PeekContext(ctx, 5); err != context.Canceled {
+		t.Errorf("PeekContext() with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPeekBuffer_PeekContextGoroutine(t *testing.T) {
+	pr, pw := io.Pipe()
+	pb := NewPeekBuffer(pr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	got, err := pb.PeekContext(ctx, 5)
+	if err != context.DeadlineExceeded || len(got) != 0 {
+		t.Errorf("PeekContext() got = %q, err %v, want %v", string(got), err, context.DeadlineExceeded)
+	}
+
+	// The read left in flight must be collected rather than lost.
+	go func() {
+		pw.Write([]byte("hello"))
+		pw.Write([]byte(" world"))
+		pw.Close()
+	}()
+	got, err = pb.PeekContext(context.Background(), 11)
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("PeekContext() got = %q, err %v, want %q", string(got), err, "hello world")
+	}
+	remaining, err := io.ReadAll(pb)
+	if err != nil || string(remaining) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, "hello world")
+	}
+}
+
+// ScriptedReader is a mock reader whose reads return the given data and errors in turn, then io.EOF
+type ScriptedReader struct {
+	reads []pendingRead
+}
+
+func (r *ScriptedReader) Read(p []byte) (int, error) {
+	if len(r.reads) == 0 {
+		return 0, io.EOF
+	}
+	read := r.reads[0]
+	r.reads = r.reads[1:]
+	return copy(p, read.data), read.err
+}
+
+func TestPeekBuffer_PeekContextDataWithError(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{"Error", readErr, readErr},
+		{"EOF", io.EOF, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newReader := func() io.Reader {
+				return &ScriptedReader{reads: []pendingRead{{[]byte("abc"), tt.err}, {[]byte("GARBAGE"), nil}}}
+			}
+
+			pb := NewPeekBuffer(newReader())
+			got, err := pb.PeekContext(context.Background(), 10)
+			if string(got) != "abc" || err != tt.wantErr {
+				t.Errorf("PeekContext() got = %q, err %v, want %q, %v", got, err, "abc", tt.wantErr)
+			}
+
+			// Peek agrees
+			got, err = NewPeekBuffer(newReader()).Peek(10)
+			if string(got) != "abc" || err != tt.wantErr {
+				t.Errorf("Peek() got = %q, err %v, want %q, %v", got, err, "abc", tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekContextPendingRead(t *testing.T) {
+	pr, pw := io.Pipe()
+	pb := NewPeekBuffer(pr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pb.PeekContext(ctx, 5); err != context.DeadlineExceeded {
+		t.Fatalf("PeekContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	go func() {
+		pw.Write([]byte("hello world"))
+		pw.Close()
+	}()
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v, want %q", string(got), err, "hello world")
+	}
+}
+
+func TestPeekBuffer_PeekContextPendingReadBuffered(t *testing.T) {
+	pr, pw := io.Pipe()
+	pb := NewPeekBuffer(pr)
+	go pw.Write([]byte("0123456789"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if got, err := pb.PeekContext(ctx, 20); err != context.DeadlineExceeded || string(got) != "0123456789" {
+		t.Fatalf("PeekContext() got = %q, err %v, want %q, %v", got, err, "0123456789", context.DeadlineExceeded)
+	}
+
+	// The buffered data is served without waiting for the silent peer
+	done := make(chan struct{})
+	var got bytes.Buffer
+	go func() {
+		defer close(done)
+		buf := make([]byte, 5)
+		n, _ := pb.Read(buf)
+		got.Write(buf[:n])
+		pb.Discard(2)
+		pb.CopyN(&got, 3)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Read, Discard and CopyN waited for the read left in flight")
+	}
+	if got.String() != "01234789" {
+		t.Errorf("got = %q, want %q", got.String(), "01234789")
+	}
+
+	go func() {
+		pw.Write([]byte("abc"))
+		pw.Close()
+	}()
+	rest, err := io.ReadAll(pb)
+	if err != nil || string(rest) != "abc" {
+		t.Errorf("ReadAll() got = %q, err %v, want %q", rest, err, "abc")
+	}
+}
+
+func TestPeekBuffer_PeekContextDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	pb := NewPeekBuffer(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := pb.PeekContext(ctx, 5); err != context.Canceled {
+		t.Errorf("PeekContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	// The deadline must be cleared so the connection is still usable.
+	go server.Write([]byte("hello"))
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := pb.PeekContext(ctx, 5)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("PeekContext() got = %q, err %v, want %q", string(got), err, "hello")
+	}
+}
@@ -0,0 +1,53 @@
+package peekbuffer
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoDeadline is returned by SetDeadline when the underlying reader does not support read deadlines.
+var ErrNoDeadline = errors.New("peekbuffer: underlying reader does not support read deadlines")
+
+// SetDeadline bounds every read from the underlying reader by t, for readers such as net.Conn and *os.File that
+// support read deadlines. The deadline is applied to the reader before each read made to fill the buffer or to serve
+// a Read, so it stays in force even if the reader's own deadline is changed behind the PeekBuffer's back.
+// This gives timeout control for the common connection case without the goroutine machinery of PeekContext.
+// Reads that can be served from buffered data succeed regardless of the deadline, and a timeout is not remembered,
+// so the stream can be read again once the deadline is moved. A zero t clears the deadline.
+//
+// Parameters:
+//   - t time.Time: The deadline for reads from the underlying reader, or the zero time for no deadline.
+//
+// Returns:
+//   - error: ErrNoDeadline if the underlying reader does not implement SetReadDeadline,
+//     or any error returned by its SetReadDeadline method.
+func (this *PeekBuffer) SetDeadline(t time.Time) error {
+	deadliner, ok := this.reader.(readDeadliner)
+	if !ok {
+		return ErrNoDeadline
+	}
+	if err := deadliner.SetReadDeadline(t); err != nil {
+		return err
+	}
+	this.deadline = t
+	return nil
+}
+
+// read reads from the underlying reader, first applying the deadline set by SetDeadline.
+func (this *PeekBuffer) read(p []byte) (int, error) {
+	if err := this.applyDeadline(); err != nil {
+		return 0, err
+	}
+	return this.reader.Read(p)
+}
+
+// applyDeadline sets the read deadline of the underlying reader to the one set by SetDeadline, if there is one.
+func (this *PeekBuffer) applyDeadline() error {
+	if this.deadline.IsZero() {
+		return nil
+	}
+	if deadliner, ok := this.reader.(readDeadliner); ok {
+		return deadliner.SetReadDeadline(this.deadline)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package peekbuffer
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPeekBuffer_SetDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	pb := NewPeekBuffer(client)
+
+	if err := pb.SetDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetDeadline() error = %v", err)
+	}
+	if _, err := pb.Peek(1); !os.IsTimeout(err) {
+		t.Errorf("Peek() error = %v, want a timeout", err)
+	}
+	if _, err := pb.Read(make([]byte, 1)); !os.IsTimeout(err) {
+		t.Errorf("Read() error = %v, want a timeout", err)
+	}
+
+	// The deadline is applied again before each read, even if it was changed on the reader
+	client.SetReadDeadline(time.Time{})
+	if _, err := pb.Discard(1); !os.IsTimeout(err) {
+		t.Errorf("Discard() after clearing the reader's deadline error = %v, want a timeout", err)
+	}
+
+	if err := pb.SetDeadline(time.Time{}); err != nil {
+		t.Fatalf("SetDeadline() error = %v", err)
+	}
+	go server.Write([]byte("ok"))
+	if peeked, err := pb.Peek(2); err != nil || string(peeked) != "ok" {
+		t.Errorf("Peek() after clearing deadline got = %q, err %v", peeked, err)
+	}
+}
+
+func TestPeekBuffer_SetDeadlinePeekContext(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	pb := NewPeekBuffer(client)
+
+	// The earlier deadline set by SetDeadline bounds PeekContext
+	if err := pb.SetDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetDeadline() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := pb.PeekContext(ctx, 1); !os.IsTimeout(err) {
+		t.Errorf("PeekContext() error = %v, want a timeout", err)
+	}
+
+	// and is restored once PeekContext returns
+	if err := pb.SetDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("SetDeadline() error = %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := pb.PeekContext(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("PeekContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := client.Read(make([]byte, 1)); !os.IsTimeout(err) {
+		t.Errorf("Read() after PeekContext error = %v, want the restored deadline to time out", err)
+	}
+}
+
+func TestPeekBuffer_SetDeadlineUnsupported(t *testing.T) {
+	pb := NewPeekBuffer(strings.NewReader("hello"))
+	if err := pb.SetDeadline(time.Now()); err != ErrNoDeadline {
+		t.Errorf("SetDeadline() error = %v, want %v", err, ErrNoDeadline)
+	}
+	if got, err := io.ReadAll(pb); err != nil || string(got) != "hello" {
+		t.Errorf("ReadAll() got = %q, err %v", got, err)
+	}
+}
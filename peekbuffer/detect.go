@@ -0,0 +1,188 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+)
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// Compression identifies the compression format of a stream.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZlib
+	CompressionBzip2
+	CompressionXz
+	CompressionZstd
+)
+
+// String returns the name of the compression format.
+func (this Compression) String() string {
+	switch this {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZlib:
+		return "zlib"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionXz:
+		return "xz"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return "unknown"
+}
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// byteOrderMarks lists the recognised byte order marks. The UTF-32 marks come first because
+// the UTF-32LE mark starts with the UTF-16LE mark.
+var byteOrderMarks = []struct {
+	encoding string
+	bom      []byte
+}{
+	{"UTF-32BE", []byte{0x00, 0x00, 0xfe, 0xff}},
+	{"UTF-32LE", []byte{0xff, 0xfe, 0x00, 0x00}},
+	{"UTF-8", []byte{0xef, 0xbb, 0xbf}},
+	{"UTF-16BE", []byte{0xfe, 0xff}},
+	{"UTF-16LE", []byte{0xff, 0xfe}},
+}
+
+// DetectContentType determines the MIME type of the stream using http.DetectContentType,
+// without consuming any data. Only the first 512 bytes, or fewer if a smaller maximum buffer size
+// is configured, are examined.
+//
+// Returns:
+//   - string: The detected MIME type, "application/octet-stream" if no more specific type was found.
+//   - error: Any error encountered during peeking, or nil if successful.
+func (this *PeekBuffer) DetectContentType() (string, error) {
+	peeked, err := this.peek(sniffLen)
+	if err != nil && err != ErrBufferFull {
+		return "", err
+	}
+	return http.DetectContentType(peeked), nil
+}
+
+// DetectCompression determines the compression format of the stream from its magic number,
+// without consuming any data, so the untouched stream can be handed to the matching decompressor.
+// A zlib stream is recognised by a valid deflate header, which is only two bytes with a checksum,
+// so short streams of other data may occasionally be reported as zlib.
+//
+// Returns:
+//   - Compression: The detected compression format, or CompressionNone if the stream is not compressed
+//     with a recognised format or is too short to tell.
+//   - error: Any error encountered during peeking, or nil if successful.
+func (this *PeekBuffer) DetectCompression() (Compression, error) {
+	peeked, err := this.peek(len(magicXz))
+	if err != nil && err != ErrBufferFull {
+		return CompressionNone, err
+	}
+
+	switch {
+	case bytes.HasPrefix(peeked, magicGzip):
+		return CompressionGzip, nil
+	case bytes.HasPrefix(peeked, magicXz):
+		return CompressionXz, nil
+	case bytes.HasPrefix(peeked, magicZstd):
+		return CompressionZstd, nil
+	case len(peeked) >= 4 && bytes.HasPrefix(peeked, magicBzip2) && peeked[3] >= '1' && peeked[3] <= '9':
+		return CompressionBzip2, nil
+	case len(peeked) >= 2 && isZlibHeader(peeked[0], peeked[1]):
+		return CompressionZlib, nil
+	}
+	return CompressionNone, nil
+}
+
+// MaybeDecompress detects the compression format of the stream and returns a reader that decompresses it, so the
+// sniff-then-wrap pattern takes a single call. The decompressor reads through the PeekBuffer, so the peeked magic
+// number is fed to it along with the rest of the stream, and since the PeekBuffer is an io.ByteReader the gzip and
+// zlib decompressors consume exactly the compressed data without buffering ahead. Once a zlib stream has been read
+// to the end, the PeekBuffer is positioned at the first byte after it, whereas the gzip and bzip2 readers go on to
+// read concatenated streams until the PeekBuffer ends.
+// The PeekBuffer must not be read directly while the returned reader is in use.
+// Streams in a format the standard library cannot decompress, such as xz and zstd, are returned unchanged along
+// with plain streams; use DetectCompression to tell them apart. As DetectCompression notes, a plain stream may
+// start with bytes that look like a zlib header, in which case decompression fails with an error from compress/zlib
+// or compress/flate.
+//
+// Returns:
+//   - io.Reader: A *gzip.Reader, a zlib reader or a bzip2 reader for a compressed stream, otherwise the PeekBuffer itself.
+//   - error: Any error encountered during peeking, or the error returned by gzip.NewReader or zlib.NewReader if
+//     the header is invalid, otherwise nil.
+func (this *PeekBuffer) MaybeDecompress() (io.Reader, error) {
+	compression, err := this.DetectCompression()
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	switch compression {
+	case CompressionGzip:
+		reader, err = gzip.NewReader(this)
+	case CompressionZlib:
+		reader, err = zlib.NewReader(this)
+	case CompressionBzip2:
+		reader = bzip2.NewReader(this)
+	default:
+		reader = this
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// isZlibHeader reports whether cmf and flg form a valid zlib header for a deflate stream.
+func isZlibHeader(cmf, flg byte) bool {
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && (uint16(cmf)<<8|uint16(flg))%31 == 0
+}
+
+// PeekBOM detects a Unicode byte order mark at the start of the stream without consuming any data.
+// A stream starting with FF FE 00 00 is reported as UTF-32LE, although it could also be UTF-16LE text
+// starting with a NUL character.
+//
+// Returns:
+//   - encoding string: "UTF-8", "UTF-16BE", "UTF-16LE", "UTF-32BE" or "UTF-32LE", or "" if there is no byte order mark.
+//   - bomLen int: The length of the byte order mark in bytes, or 0 if there is none.
+//   - err error: Any error encountered during peeking, or nil if successful.
+func (this *PeekBuffer) PeekBOM() (encoding string, bomLen int, err error) {
+	peeked, err := this.peek(4)
+	if err != nil && err != ErrBufferFull {
+		return "", 0, err
+	}
+	for _, mark := range byteOrderMarks {
+		if bytes.HasPrefix(peeked, mark.bom) {
+			return mark.encoding, len(mark.bom), nil
+		}
+	}
+	return "", 0, nil
+}
+
+// SkipBOM consumes a Unicode byte order mark at the start of the stream if there is one,
+// so that text parsers see only the content. The stream is left untouched if there is none.
+//
+// Returns:
+//   - encoding string: The encoding indicated by the byte order mark, as reported by PeekBOM, or "" if there is none.
+//   - err error: Any error encountered during peeking, or nil if successful.
+func (this *PeekBuffer) SkipBOM() (encoding string, err error) {
+	encoding, bomLen, err := this.PeekBOM()
+	if err != nil {
+		return "", err
+	}
+	this.advance(bomLen)
+	return encoding, nil
+}
@@ -0,0 +1,208 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPeekBuffer_DetectContentType(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"HTML", "<!DOCTYPE html><html></html>", "text/html; charset=utf-8"},
+		{"PNG", "\x89PNG\x0d\x0a\x1a\x0a\x00\x00\x00\x0dIHDR", "image/png"},
+		{"Gzip", "\x1f\x8b\x08\x00\x00\x00\x00\x00", "application/x-gzip"},
+		{"Text", "hello world", "text/plain; charset=utf-8"},
+		{"Empty", "", "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			got, err := pb.DetectContentType()
+			if err != nil || got != tt.want {
+				t.Errorf("DetectContentType() got = %q, err %v, want %q", got, err, tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.input)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_DetectCompression(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Compression
+	}{
+		{"Gzip", "\x1f\x8b\x08\x00\x00\x00\x00\x00", CompressionGzip},
+		{"Zlib default", "\x78\x9c\x4b\x4c", CompressionZlib},
+		{"Zlib best", "\x78\xda\x4b\x4c", CompressionZlib},
+		{"Zlib fastest", "\x78\x01\x4b\x4c", CompressionZlib},
+		{"Bzip2", "BZh91AY&SY", CompressionBzip2},
+		{"Xz", "\xfd7zXZ\x00\x00\x04", CompressionXz},
+		{"Zstd", "\x28\xb5\x2f\xfd\x04\x00", CompressionZstd},
+		{"Plain", "hello world", CompressionNone},
+		{"Bzip2 without level", "BZh0", CompressionNone},
+		{"Bad zlib checksum", "\x78\x9d", CompressionNone},
+		{"Too short", "\x1f", CompressionNone},
+		{"Truncated xz", "\xfd7zX", CompressionNone},
+		{"Empty", "", CompressionNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			got, err := pb.DetectCompression()
+			if err != nil || got != tt.want {
+				t.Errorf("DetectCompression() got = %v, err %v, want %v", got, err, tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.input)
+			}
+		})
+	}
+}
+
+// bzip2Hello is "hello world\n" compressed with bzip2, which the standard library cannot write.
+var bzip2Hello = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x4e, 0xec,
+	0xe8, 0x36, 0x00, 0x00, 0x02, 0x51, 0x80, 0x00, 0x10, 0x40, 0x00, 0x06,
+	0x44, 0x90, 0x80, 0x20, 0x00, 0x31, 0x06, 0x4c, 0x41, 0x01, 0xa7, 0xa9,
+	0xa5, 0x80, 0xbb, 0x94, 0x31, 0xf8, 0xbb, 0x92, 0x29, 0xc2, 0x84, 0x82,
+	0x77, 0x67, 0x41, 0xb0,
+}
+
+func TestPeekBuffer_MaybeDecompress(t *testing.T) {
+	compress := func(newWriter func(w io.Writer) io.WriteCloser) []byte {
+		var compressed bytes.Buffer
+		w := newWriter(&compressed)
+		w.Write([]byte("hello world\n"))
+		w.Close()
+		return compressed.Bytes()
+	}
+	gzipped := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	zlibbed := compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+
+	tests := []struct {
+		name     string
+		input    []byte
+		want     string
+		wantRest string
+	}{
+		{"Gzip", gzipped, "hello world\n", ""},
+		{"Zlib", zlibbed, "hello world\n", ""},
+		{"Zlib then trailer", append(append([]byte(nil), zlibbed...), "trailer"...), "hello world\n", "trailer"},
+		{"Bzip2", bzip2Hello, "hello world\n", ""},
+		{"Plain", []byte("hello world\n"), "hello world\n", ""},
+		{"Xz unchanged", []byte("\xfd7zXZ\x00\x00\x04"), "\xfd7zXZ\x00\x00\x04", ""},
+		{"Empty", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Small fill size so the decompressor has to read well past the peeked magic number
+			pb := NewPeekBufferSize(bytes.NewReader(tt.input), 4)
+			reader, err := pb.MaybeDecompress()
+			if err != nil {
+				t.Fatalf("MaybeDecompress() error = %v", err)
+			}
+
+			got, err := io.ReadAll(reader)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", got, err, tt.want)
+			}
+			rest, err := io.ReadAll(pb)
+			if err != nil || string(rest) != tt.wantRest {
+				t.Errorf("ReadAll() after decompressing got = %q, err %v, want %q", rest, err, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_MaybeDecompressPlain(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if reader, err := pb.MaybeDecompress(); err != nil || reader != io.Reader(pb) {
+		t.Errorf("MaybeDecompress() got = %v, err %v, want the PeekBuffer itself", reader, err)
+	}
+}
+
+func TestPeekBuffer_MaybeDecompressErrors(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		wantErr error
+	}{
+		{"Bad gzip header", bytes.NewReader([]byte("\x1f\x8b\x00\x00\x00\x00\x00\x00\x00\x00")), gzip.ErrHeader},
+		{"Truncated gzip header", bytes.NewReader([]byte("\x1f\x8b\x08")), io.ErrUnexpectedEOF},
+		{"Zlib dictionary", bytes.NewReader([]byte("\x78\xbb\x00\x00\x00\x02")), zlib.ErrDictionary},
+		{"Read error", &ErrorReader{err: readErr}, readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader)
+			reader, err := pb.MaybeDecompress()
+			if reader != nil || err != tt.wantErr {
+				t.Errorf("MaybeDecompress() got = %v, err %v, want nil, %v", reader, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekBOM(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		encoding string
+		bomLen   int
+	}{
+		{"UTF-8", "\xef\xbb\xbfhello", "UTF-8", 3},
+		{"UTF-8 only", "\xef\xbb\xbf", "UTF-8", 3},
+		{"UTF-16BE", "\xfe\xff\x00h", "UTF-16BE", 2},
+		{"UTF-16LE", "\xff\xfeh\x00", "UTF-16LE", 2},
+		{"UTF-16LE only", "\xff\xfe", "UTF-16LE", 2},
+		{"UTF-32BE", "\x00\x00\xfe\xff\x00\x00\x00h", "UTF-32BE", 4},
+		{"UTF-32LE", "\xff\xfe\x00\x00h\x00\x00\x00", "UTF-32LE", 4},
+		{"Truncated UTF-8", "\xef\xbb", "", 0},
+		{"Plain", "hello", "", 0},
+		{"Empty", "", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			encoding, bomLen, err := pb.PeekBOM()
+			if err != nil || encoding != tt.encoding || bomLen != tt.bomLen {
+				t.Errorf("PeekBOM() got = %q, %d, err %v, want %q, %d", encoding, bomLen, err, tt.encoding, tt.bomLen)
+			}
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() after PeekBOM got = %q, err %v, want %q", string(remaining), err, tt.input)
+			}
+
+			pb = NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			encoding, err = pb.SkipBOM()
+			if err != nil || encoding != tt.encoding {
+				t.Errorf("SkipBOM() got = %q, err %v, want %q", encoding, err, tt.encoding)
+			}
+			remaining, err = io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input[tt.bomLen:] {
+				t.Errorf("ReadAll() after SkipBOM got = %q, err %v, want %q", string(remaining), err, tt.input[tt.bomLen:])
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package peekbuffer
+
+import (
+	"io"
+	"math"
+)
+
+// Option configures a PeekBuffer created by New.
+type Option func(*PeekBuffer)
+
+// New creates and returns a new PeekBuffer instance that wraps the provided reader, configured by opts.
+// Options are applied in order, after the defaults used by NewPeekBuffer have been set.
+//
+// Parameters:
+//   - reader io.Reader: The underlying reader to wrap.
+//   - opts ...Option: Options that configure the PeekBuffer.
+//
+// Returns:
+//   - *PeekBuffer: A new PeekBuffer instance.
+func New(reader io.Reader, opts ...Option) *PeekBuffer {
+	this := &PeekBuffer{
+		reader:   reader,
+		fillSize: FillPeekBufferSize,
+	}
+	for _, opt := range opts {
+		opt(this)
+	}
+	return this
+}
+
+// WithFillSize sets the chunk size used when reading from the underlying reader, replacing FillPeekBufferSize.
+//
+// Parameters:
+//   - fillSize int: The fill size. Must be at least 1.
+//
+// Panics if fillSize is less than 1.
+func WithFillSize(fillSize int) Option {
+	if fillSize < 1 {
+		panic("peekbuffer: fill size must be at least 1")
+	}
+	return func(this *PeekBuffer) {
+		this.fillSize = fillSize
+	}
+}
+
+// WithMaxBuffer limits how many bytes the internal buffer may hold. See SetMaxBuffer.
+//
+// Parameters:
+//   - size int: The maximum number of buffered bytes, or 0 to allow the buffer to grow without limit.
+func WithMaxBuffer(size int) Option {
+	return func(this *PeekBuffer) {
+		this.SetMaxBuffer(size)
+	}
+}
+
+// WithInitialCapacity allocates room for capacity bytes in the internal buffer up front,
+// avoiding reallocations while the first peeks grow the buffer. Like the capacity asked for by Grow, the
+// backing array is kept once the buffer is drained.
+//
+// Parameters:
+//   - capacity int: The initial capacity of the internal buffer in bytes.
+func WithInitialCapacity(capacity int) Option {
+	return func(this *PeekBuffer) {
+		if capacity > 0 {
+			this.buffer = make([]byte, capacity)
+			this.capacity = capacity
+		}
+	}
+}
+
+// WithStrictEOF makes Peek, PeekContext and PeekString report a stream that ends before the requested number of bytes,
+// returning io.ErrUnexpectedEOF with the bytes that were available, or io.EOF if there were none,
+// instead of a short slice and a nil error. This lets strict decoders detect truncated frames.
+// Methods that interpret a short peek themselves, such as HasPrefix and PeekFull, are unaffected.
+func WithStrictEOF() Option {
+	return func(this *PeekBuffer) {
+		this.strictEOF = true
+	}
+}
+
+// WithGreedyRead, when enabled is true, makes Read continue with the underlying reader once it has drained the buffered data, so a
+// single Read returns as much as possible instead of stopping short at the end of the buffer, as most wrapping
+// readers do. A Read that finds data buffered copies it into p and, if p has room left, makes exactly one more
+// read from the underlying reader into the rest of p, which may itself return less than asked for. An error
+// from that read is not returned alongside the buffered data but by the next Read, so nothing is lost. A Read
+// that finds nothing buffered, or that is satisfied from the buffer, behaves as without the option.
+// Because the extra read can block, this does not suit interactive streams where the peer waits for a reply to
+// data that is already buffered; use ReadFill to fill p completely.
+//
+// Parameters:
+//   - enabled bool: Whether Read continues with the underlying reader. False keeps the default behavior.
+func WithGreedyRead(enabled bool) Option {
+	return func(this *PeekBuffer) {
+		this.greedyRead = enabled
+	}
+}
+
+// WithShrinkPolicy releases memory held by a large backing array as soon as consuming data leaves fewer than
+// minRetain bytes in it, by copying the remainder into a right-sized array. This suits long-lived PeekBuffers
+// that occasionally peek a large header but then process small records. Without it a large array is only
+// released once it is drained or more than half of it has been consumed. Bytes retained by Mark or Snapshot
+// count towards the remainder, and arrays no larger than the fill size or than twice minRetain are kept.
+//
+// Parameters:
+//   - minRetain int: The number of remaining bytes below which the buffer is shrunk, or 0 to disable the policy.
+func WithShrinkPolicy(minRetain int) Option {
+	return func(this *PeekBuffer) {
+		if minRetain < 0 {
+			minRetain = 0
+		}
+		this.shrinkBelow = minRetain
+	}
+}
+
+// WithHistory retains the last n consumed bytes so they can be inspected with History, a bounded look-behind that
+// complements the forward Peek. The history is kept in the internal buffer, so memory grows by at most n bytes
+// and the retained bytes do not count towards the maximum buffer size. Reads are always served through the buffer
+// while a history is kept, so large reads are copied once more than they would be otherwise.
+//
+// Parameters:
+//   - n int: The number of consumed bytes to retain, or 0 to retain none.
+func WithHistory(n int) Option {
+	return func(this *PeekBuffer) {
+		if n < 0 {
+			n = 0
+		}
+		this.historySize = n
+	}
+}
+
+// WithGrowthFactor sets the factor by which the internal buffer grows when a Peek needs more room than it has.
+// The default of 2 doubles the buffer, so a peek that grows steadily, such as PeekUntil scanning for a distant
+// delimiter, is amortized like append: it reallocates and copies a logarithmic number of times and each read can
+// fill the larger free space. A factor of 1 grows the buffer only to the next multiple of the fill size that
+// holds the data, which keeps memory tight at the cost of a reallocation and a fill size read per step, and larger
+// factors trade more memory for fewer reallocations. The growth never exceeds the maximum buffer size.
+//
+// Parameters:
+//   - f float64: The growth factor. Must be at least 1 and finite.
+//
+// Panics if f is less than 1, infinite or NaN.
+func WithGrowthFactor(f float64) Option {
+	if !(f >= 1) || math.IsInf(f, 1) {
+		panic("peekbuffer: growth factor must be at least 1")
+	}
+	return func(this *PeekBuffer) {
+		this.growthFactor = f
+	}
+}
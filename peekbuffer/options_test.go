@@ -0,0 +1,315 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNew(t *testing.T) {
+	reader := bytes.NewReader([]byte("hello world"))
+	pb := New(reader)
+	if pb.reader != reader {
+		t.Error("New did not set the reader correctly")
+	}
+	if pb.fillSize != FillPeekBufferSize || pb.maxSize != 0 || pb.buffer != nil {
+		t.Errorf("New() got fillSize %d, maxSize %d, capacity %d, want defaults", pb.fillSize, pb.maxSize, len(pb.buffer))
+	}
+}
+
+func TestNew_Options(t *testing.T) {
+	pb := New(bytes.NewReader([]byte("hello world")), WithFillSize(3), WithMaxBuffer(8), WithInitialCapacity(100))
+	if pb.fillSize != 3 {
+		t.Errorf("WithFillSize() fillSize = %d, want 3", pb.fillSize)
+	}
+	if pb.maxSize != 8 {
+		t.Errorf("WithMaxBuffer() maxSize = %d, want 8", pb.maxSize)
+	}
+	if len(pb.buffer) != 100 {
+		t.Errorf("WithInitialCapacity() capacity = %d, want 100", len(pb.buffer))
+	}
+
+	peeked, err := pb.Peek(20)
+	if err != ErrBufferFull || string(peeked) != "hello wo" {
+		t.Errorf("Peek() got = %q, err %v, want %q, %v", string(peeked), err, "hello wo", ErrBufferFull)
+	}
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v", string(got), err)
+	}
+}
+
+func TestWithFillSize_Invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithFillSize(0) did not panic")
+		}
+	}()
+	WithFillSize(0)
+}
+
+func TestWithStrictEOF(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		size    int
+		want    string
+		wantErr error
+	}{
+		{"Enough data", "hello world", 5, "hello", nil},
+		{"Exact", "hello", 5, "hello", nil},
+		{"Truncated", "hel", 5, "hel", io.ErrUnexpectedEOF},
+		{"Empty", "", 5, "", io.EOF},
+		{"Zero size", "", 0, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := New(bytes.NewReader([]byte(tt.input)), WithStrictEOF())
+			got, err := pb.Peek(tt.size)
+			if string(got) != tt.want || err != tt.wantErr {
+				t.Errorf("Peek() got = %q, err %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+			gotString, err := pb.PeekString(tt.size)
+			if gotString != tt.want || err != tt.wantErr {
+				t.Errorf("PeekString() got = %q, err %v, want %q, %v", gotString, err, tt.want, tt.wantErr)
+			}
+			got, err = pb.PeekContext(context.Background(), tt.size)
+			if string(got) != tt.want || err != tt.wantErr {
+				t.Errorf("PeekContext() got = %q, err %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+
+			// Methods that check the length themselves keep their own semantics
+			if ok, err := pb.HasPrefix([]byte("hello")); err != nil || ok != strings.HasPrefix(tt.input, "hello") {
+				t.Errorf("HasPrefix() got = %v, err %v", ok, err)
+			}
+			if _, err := pb.DetectContentType(); err != nil {
+				t.Errorf("DetectContentType() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithGreedyRead(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name        string
+		reader      func() io.Reader
+		greedy      bool
+		size        int
+		want        string
+		wantNext    string
+		wantNextErr error
+	}{
+		{"Disabled", func() io.Reader { return strings.NewReader("hello world") }, false, 8, "hell", "o wo", nil},
+		{"Buffer then reader", func() io.Reader { return strings.NewReader("hello world") }, true, 8, "hello wo", "rld", nil},
+		{"Satisfied from buffer", func() io.Reader { return strings.NewReader("hello world") }, true, 3, "hel", "lo w", nil},
+		{"Short read", func() io.Reader { return iotest.OneByteReader(strings.NewReader("hello world")) }, true, 8, "hel", "l", nil},
+		{"End of stream", func() io.Reader { return strings.NewReader("hell") }, true, 8, "hell", "", io.EOF},
+		{"Error deferred", func() io.Reader {
+			return io.MultiReader(strings.NewReader("hell"), &ErrorReader{err: readErr})
+		}, true, 8, "hell", "", readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := New(tt.reader(), WithFillSize(4), WithGreedyRead(tt.greedy))
+			var tee bytes.Buffer
+			pb.SetTee(&tee)
+			if _, err := pb.Peek(2); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+
+			p := make([]byte, tt.size)
+			n, err := pb.Read(p)
+			if string(p[:n]) != tt.want || err != nil {
+				t.Errorf("Read() got = %q, err %v, want %q, nil", p[:n], err, tt.want)
+			}
+			next := make([]byte, 4)
+			n, err = pb.Read(next)
+			if string(next[:n]) != tt.wantNext || err != tt.wantNextErr {
+				t.Errorf("second Read() got = %q, err %v, want %q, %v", next[:n], err, tt.wantNext, tt.wantNextErr)
+			}
+			if tee.String() != tt.want+tt.wantNext {
+				t.Errorf("tee got = %q, want %q", tee.String(), tt.want+tt.wantNext)
+			}
+			if pb.Offset() != int64(tee.Len()) {
+				t.Errorf("Offset() = %d, want %d", pb.Offset(), tee.Len())
+			}
+		})
+	}
+}
+
+func TestWithShrinkPolicy(t *testing.T) {
+	input := benchmarkInput()[:3000]
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		read       int
+		marked     bool
+		wantShrunk bool
+	}{
+		{"Default", nil, 2500, false, false},
+		{"Above threshold", []Option{WithShrinkPolicy(1000)}, 1500, false, false},
+		{"Below threshold", []Option{WithShrinkPolicy(1000)}, 2500, false, true},
+		{"Retained", []Option{WithShrinkPolicy(1000)}, 2500, true, false},
+		{"Disabled", []Option{WithShrinkPolicy(0)}, 2500, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := New(bytes.NewReader(input), tt.opts...)
+			if tt.marked {
+				pb.Mark()
+			}
+			// A large peek on a short stream leaves a backing array much larger than the data
+			pb.Peek(64 << 10)
+			capacity := len(pb.buffer)
+
+			if _, err := io.ReadFull(pb, make([]byte, tt.read)); err != nil {
+				t.Fatalf("ReadFull() error = %v", err)
+			}
+			if shrunk := len(pb.buffer) < capacity; shrunk != tt.wantShrunk {
+				t.Errorf("capacity after reading %d bytes = %d, was %d, want shrunk %v", tt.read, len(pb.buffer), capacity, tt.wantShrunk)
+			}
+			if tt.marked {
+				pb.Rewind()
+			}
+			offset := pb.Offset()
+			got, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(got, input[offset:]) {
+				t.Errorf("ReadAll() got %d bytes, err %v, want %d", len(got), err, len(input)-int(offset))
+			}
+		})
+	}
+}
+
+func TestWithHistory(t *testing.T) {
+	input := benchmarkInput()[:20000]
+
+	tests := []struct {
+		name string
+		size int
+		read func(pb *PeekBuffer)
+		want func(offset int64) []byte
+	}{
+		{"Start of stream", 8, func(pb *PeekBuffer) {}, func(int64) []byte { return nil }},
+		{"Short", 8, func(pb *PeekBuffer) { pb.Discard(3) }, func(int64) []byte { return input[:3] }},
+		{"Read", 8, func(pb *PeekBuffer) { io.ReadFull(pb, make([]byte, 15000)) }, nil},
+		{"ReadByte", 8, func(pb *PeekBuffer) {
+			for i := 0; i < 9000; i++ {
+				pb.ReadByte()
+			}
+		}, nil},
+		{"Discard", 100, func(pb *PeekBuffer) { pb.Discard(12000) }, nil},
+		{"Peek then read", 8, func(pb *PeekBuffer) {
+			pb.Peek(5000)
+			io.ReadFull(pb, make([]byte, 4000))
+		}, nil},
+		{"Rewind", 8, func(pb *PeekBuffer) {
+			pb.Discard(100)
+			pb.Mark()
+			pb.Discard(5000)
+			pb.Rewind()
+		}, nil},
+		{"Unread", 8, func(pb *PeekBuffer) {
+			pb.Discard(100)
+			pb.Unread([]byte("xy"))
+		}, nil},
+		{"Unread read bytes", 8, func(pb *PeekBuffer) {
+			pb.Discard(100)
+			pb.Unread(input[96:100])
+		}, nil},
+		{"Unread short", 8, func(pb *PeekBuffer) {
+			pb.Discard(4)
+			pb.Unread([]byte("xy"))
+		}, func(int64) []byte { return input[:2] }},
+		{"Unread past start", 8, func(pb *PeekBuffer) {
+			pb.Discard(2)
+			pb.Unread([]byte("wxyz"))
+		}, func(int64) []byte { return nil }},
+		{"UnreadByte", 8, func(pb *PeekBuffer) {
+			pb.Discard(100)
+			pb.ReadByte()
+			pb.UnreadByte()
+		}, nil},
+		{"Read all", 8, func(pb *PeekBuffer) { io.ReadAll(pb) }, nil},
+		{"Disabled", 0, func(pb *PeekBuffer) { pb.Discard(100) }, func(int64) []byte { return nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := New(bytes.NewReader(input), WithFillSize(1000), WithHistory(tt.size), WithMaxBuffer(2000))
+			tt.read(pb)
+
+			var want []byte
+			if tt.want != nil {
+				want = tt.want(pb.Offset())
+			} else {
+				want = input[pb.Offset()-int64(tt.size) : pb.Offset()]
+			}
+			if got := pb.History(); !bytes.Equal(got, want) {
+				t.Errorf("History() at offset %d got = %q, want %q", pb.Offset(), got, want)
+			}
+		})
+	}
+
+	// The history does not hold on to more than it needs
+	pb := New(bytes.NewReader(input), WithFillSize(1000), WithHistory(8))
+	io.ReadAll(pb)
+	if len(pb.buffer) > 2000 {
+		t.Errorf("WithHistory() kept a buffer of %d bytes", len(pb.buffer))
+	}
+}
+
+func TestWithGrowthFactor(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantCap []int
+	}{
+		{"Default", nil, []int{200, 400, 800}},
+		{"Additive", []Option{WithGrowthFactor(1)}, []int{200, 300, 500}},
+		{"Fractional", []Option{WithGrowthFactor(1.5)}, []int{200, 300, 500}},
+		{"Quadruple", []Option{WithGrowthFactor(4)}, []int{200, 800, 800}},
+		{"Max buffer", []Option{WithGrowthFactor(4), WithMaxBuffer(450)}, []int{200, 450, 450}},
+	}
+
+	input := benchmarkInput()[:1000]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithFillSize(100)}, tt.opts...)
+			pb := New(bytes.NewReader(input), opts...)
+
+			for i, size := range []int{150, 250, 450} {
+				peeked, err := pb.Peek(size)
+				if err != nil || !bytes.Equal(peeked, input[:len(peeked)]) {
+					t.Fatalf("Peek(%d) got %d bytes, err %v", size, len(peeked), err)
+				}
+				if len(pb.buffer) != tt.wantCap[i] {
+					t.Errorf("Peek(%d) buffer size = %d, want %d", size, len(pb.buffer), tt.wantCap[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithGrowthFactor_Invalid(t *testing.T) {
+	for _, f := range []float64{0, 0.5, -2, math.Inf(1), math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithGrowthFactor(%v) did not panic", f)
+				}
+			}()
+			WithGrowthFactor(f)
+		}()
+	}
+}
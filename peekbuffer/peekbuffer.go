@@ -1,30 +1,144 @@
 // Package peekbuffer provides a reader with peeking capabilities.
 package peekbuffer
 
-import "io"
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 const FillPeekBufferSize = 4096
 
+// defaultGrowthFactor is the factor by which the internal buffer grows when WithGrowthFactor is not used.
+const defaultGrowthFactor = 2
+
+// stringPreviewLen is the number of buffered bytes shown by String.
+const stringPreviewLen = 16
+
+// maxConsecutiveEmptyReads is how many reads returning no data and no error are tolerated before
+// a fill gives up with io.ErrNoProgress, the same limit bufio uses.
+const maxConsecutiveEmptyReads = 100
+
+// ErrBufferFull is returned by Peek when the requested size exceeds the maximum buffer size
+// configured with SetMaxBuffer and the buffer already holds that many bytes.
+var ErrBufferFull = errors.New("peekbuffer: buffer full")
+
+// ErrNegativeSize is returned by Peek and the other peeking methods when size is negative.
+// It is bufio.ErrNegativeCount, so callers written against bufio.Reader keep matching it.
+var ErrNegativeSize = bufio.ErrNegativeCount
+
+// ErrNegativeOffset is returned when a negative offset is passed to PeekByte or another method taking an offset.
+var ErrNegativeOffset = errors.New("peekbuffer: negative offset")
+
+// ErrInvalidUnreadByte is returned by UnreadByte when the previous operation was not a successful ReadByte.
+var ErrInvalidUnreadByte = errors.New("peekbuffer: invalid use of UnreadByte")
+
+// ErrInvalidUnreadRune is returned by UnreadRune when the previous operation was not a successful ReadRune.
+var ErrInvalidUnreadRune = errors.New("peekbuffer: invalid use of UnreadRune")
+
+// ErrNoMark is returned by Rewind when there is no active mark.
+var ErrNoMark = errors.New("peekbuffer: no active mark")
+
+// ErrFillLimit is returned by PeekLimited when the fill limit was reached before enough data was buffered.
+var ErrFillLimit = errors.New("peekbuffer: fill limit reached")
+
+// ErrNotBuffered is returned by ConsumePeeked when fewer bytes are buffered than it was asked to consume.
+var ErrNotBuffered = errors.New("peekbuffer: not enough data buffered")
+
+// ErrOffsetConsumed is returned by ReadAt for an offset whose data was consumed and is no longer buffered.
+var ErrOffsetConsumed = errors.New("peekbuffer: offset has already been consumed")
+
+// ErrNotDelimited is returned by PeekDelimited when the next byte is not the open delimiter.
+var ErrNotDelimited = errors.New("peekbuffer: next byte is not the open delimiter")
+
+// ErrNotSeeker is returned by Seek when the underlying reader does not implement io.Seeker.
+var ErrNotSeeker = errors.New("peekbuffer: underlying reader is not an io.Seeker")
+
 // PeekBuffer is a custom reader that wraps an existing io.Reader and provides peeking capability.
 // It allows looking ahead in the input stream without consuming the data. Key features:
 //
 // 1. Implements io.Reader and io.ByteReader interfaces for compatibility with standard readers.
 // 2. Provides a Peek and PeekByte method to inspect upcoming data without advancing the read position.
 // 3. Prioritizes returning peeked data before reading from the underlying reader.
-// 4. Efficiently manages an internal buffer for storing peeked data, growing as needed.
+// 4. Efficiently manages an internal buffer for storing peeked data, reusing it across Peek and Read calls and growing it as needed.
 // 5. Handles cases where less data is available than requested during Peek operations.
 //
+// Once the underlying reader returns an error other than io.EOF or a timeout, that error is remembered and returned by
+// every later call that needs more data, after any buffered bytes have been drained, so readers that don't
+// return consistent errors still behave deterministically.
+//
+// PeekBuffer has every method of bufio.Reader, so it can be slotted into code written against an interface of
+// those methods. The semantics differ from bufio.Reader in these ways:
+//
+//   - Peek and the Read*(delim) methods grow the buffer as needed instead of failing with ErrBufferFull,
+//     unless a maximum buffer size is set.
+//   - Peek returns a short slice and a nil error when the stream ends early, where bufio.Reader returns io.EOF,
+//     unless WithStrictEOF is set.
+//   - Discard returns io.ErrUnexpectedEOF when the stream ends after some but not all bytes were skipped,
+//     where bufio.Reader returns io.EOF.
+//   - UnreadByte only undoes a ReadByte, where bufio.Reader also undoes the last byte of any other read.
+//
 // This structure is useful for scenarios requiring examination of upcoming data to make
 // processing decisions, such as detecting file types or parsing structured data streams.
 type PeekBuffer struct {
 	io.Reader
 	io.ByteReader
-	reader io.Reader
-	buffer []byte
+	reader   io.Reader
+	buffer   []byte // backing array; buffer[head:tail] holds the peeked but unread data
+	head     int
+	tail     int
+	fillSize int
+	capacity int              // backing array size asked for by Grow or WithInitialCapacity, kept once drained
+	maxSize  int              // 0 means the buffer may grow without limit
+	pending  chan pendingRead // read left in flight by PeekContext, nil if there is none
+	err      error            // first error other than io.EOF returned by the underlying reader
+	eof      bool             // whether the underlying reader returned io.EOF and no data since
+	probe    [1]byte          // scratch space for checking whether the stream has data after io.EOF
+	offset   int64            // number of bytes consumed from the stream
+	mark     int              // index in buffer of the position recorded by Mark
+	marked   bool
+	tee      io.Writer         // receives consumed bytes, nil if there is none
+	lastByte byte              // byte returned by the last operation if it was ReadByte
+	lastRune [utf8.UTFMax]byte // encoding of the rune returned by the last operation if it was ReadRune
+	runeSize int               // size of lastRune, 0 if the last operation was not ReadRune
+	unread   bool              // whether lastByte, or lastRune if runeSize is not 0, can be pushed back
+
+	snapshots    []snapshotPin // positions retained for Restore
+	lastSnapshot uint64        // id of the most recent Snapshot
+
+	recording bool // whether all consumed bytes are retained for RewindAll
+	origin    int  // index in buffer of the start of the recording
+
+	strictEOF  bool      // whether Peek reports a stream that ends early, see WithStrictEOF
+	greedyRead bool      // whether Read continues with the underlying reader once the buffer is drained
+	deadline   time.Time // applied to the underlying reader before each read, zero if there is none
+
+	shrinkBelow int // buffered length below which a large buffer is shrunk, see WithShrinkPolicy
+	historySize int // number of consumed bytes retained for History
+
+	growthFactor float64 // factor by which the backing array grows, 0 for defaultGrowthFactor
+
+	capture     io.Writer // receives consumed bytes until captureLeft runs out, nil if there is none
+	captureLeft int       // number of bytes still to be captured
+	captureFrom int64     // offset of the next byte to capture, so replayed bytes are captured once
+
+	stats  Stats
+	onFill func(n int, err error) // called after each read into the buffer, nil if there is none
 }
 
 // NewPeekBuffer creates and returns a new PeekBuffer instance that wraps the provided reader.
-// It initializes the PeekBuffer with an empty buffer.
+// It initializes the PeekBuffer with an empty buffer and a fill size of FillPeekBufferSize.
+// Use New to configure the PeekBuffer with options.
+// If reader is itself a PeekBuffer the new PeekBuffer is stacked on top of it with a buffer of its own;
+// use AsPeekBuffer to reuse an existing PeekBuffer instead.
 //
 // Parameters:
 //   - reader io.Reader: The underlying reader to wrap.
@@ -32,14 +146,70 @@ type PeekBuffer struct {
 // Returns:
 //   - *PeekBuffer: A new PeekBuffer instance.
 func NewPeekBuffer(reader io.Reader) *PeekBuffer {
-	return &PeekBuffer{
-		reader: reader,
+	return New(reader)
+}
+
+// AsPeekBuffer returns reader as a PeekBuffer, wrapping it in a new one only if it is not a PeekBuffer already.
+// Middleware that needs to peek at a stream that may have been wrapped by an earlier layer can use it to avoid
+// buffering the same data at two layers, which would make Buffered, Offset and the maximum buffer size of
+// each layer describe only part of the stream. A PeekConn is unwrapped to its embedded PeekBuffer.
+//
+// Parameters:
+//   - reader io.Reader: The reader to use as a PeekBuffer.
+//
+// Returns:
+//   - *PeekBuffer: reader itself, the PeekBuffer embedded in a PeekConn, or a new PeekBuffer wrapping reader.
+func AsPeekBuffer(reader io.Reader) *PeekBuffer {
+	switch r := reader.(type) {
+	case *PeekBuffer:
+		return r
+	case *PeekConn:
+		return r.PeekBuffer
+	}
+	return NewPeekBuffer(reader)
+}
+
+// NewPeekBufferSize creates and returns a new PeekBuffer instance that wraps the provided reader
+// and fills its internal buffer in chunks of fillSize bytes instead of FillPeekBufferSize.
+// Small fill sizes suit sniffing a few bytes from many short streams, while large fill sizes
+// reduce the number of reads when peeking far ahead. It is equivalent to New(reader, WithFillSize(fillSize)).
+//
+// Parameters:
+//   - reader io.Reader: The underlying reader to wrap.
+//   - fillSize int: The chunk size used when reading from the underlying reader. Must be at least 1.
+//
+// Returns:
+//   - *PeekBuffer: A new PeekBuffer instance.
+//
+// Panics if fillSize is less than 1.
+func NewPeekBufferSize(reader io.Reader, fillSize int) *PeekBuffer {
+	return New(reader, WithFillSize(fillSize))
+}
+
+// NewPeekBufferBytes creates and returns a new PeekBuffer instance that reads from b.
+// Because the length of the stream is known, a slice shorter than FillPeekBufferSize uses a fill size just large
+// enough to hold it, so peeking allocates a buffer sized to the data rather than a full fill chunk.
+// The data is read through a bytes.Reader and is never modified.
+//
+// Parameters:
+//   - b []byte: The data to read.
+//
+// Returns:
+//   - *PeekBuffer: A new PeekBuffer instance.
+func NewPeekBufferBytes(b []byte) *PeekBuffer {
+	// One spare byte lets the read that reports io.EOF reuse the same buffer
+	fillSize := len(b) + 1
+	if fillSize > FillPeekBufferSize {
+		fillSize = FillPeekBufferSize
 	}
+	return New(bytes.NewReader(b), WithFillSize(fillSize))
 }
 
 // Read implements the io.Reader interface.
 // It first returns any data in the buffer before reading from the wrapped reader.
-// This method may return fewer bytes than requested, even if the end of the stream hasn't been reached.
+// This method may return fewer bytes than requested, even if the end of the stream hasn't been reached:
+// while data is buffered, a Read returns only buffered data, however large p is, unless WithGreedyRead is set.
+// Use ReadFill or io.ReadFull when p must be filled.
 //
 // Parameters:
 //   - p []byte: The slice to read data into.
@@ -48,13 +218,167 @@ func NewPeekBuffer(reader io.Reader) *PeekBuffer {
 //   - n int: The number of bytes read. This may be less than len(p).
 //   - err error: Any error encountered during reading, or io.EOF if the end of the stream is reached.
 func (this *PeekBuffer) Read(p []byte) (n int, err error) {
-	if len(this.buffer) > 0 {
-		n := copy(p, this.buffer)
-		this.buffer = this.buffer[n:]
+	if this.head < this.tail {
+		n := copy(p, this.buffer[this.head:this.tail])
+		this.advance(n)
+		if this.greedyRead && n < len(p) && this.err == nil && !this.eof && this.pending == nil {
+			// The buffer is drained, so continue with one read from the underlying reader.
+			// An error is remembered, or repeated by the reader, for the next Read
+			more, _ := this.readDrained(p[n:])
+			n += more
+		}
+		return n, nil
+	}
+	return this.readDrained(p)
+}
+
+// readDrained implements Read once the buffered data has been drained.
+func (this *PeekBuffer) readDrained(p []byte) (n int, err error) {
+	if len(p) > 0 {
+		if err := this.awaitPending(); err != nil {
+			return 0, err
+		}
+		if this.head < this.tail {
+			n := copy(p, this.buffer[this.head:this.tail])
+			this.advance(n)
+			return n, nil
+		}
+	}
+	if this.retaining() && len(p) > 0 {
+		// Consumed bytes must be retained, so read through the buffer
+		if err := this.fill(1); this.head == this.tail {
+			return 0, err
+		}
+		n := copy(p, this.buffer[this.head:this.tail])
+		this.advance(n)
 		return n, nil
+	} else if this.err != nil {
+		return 0, this.err
 	} else {
-		return this.reader.Read(p)
+		n, err = this.read(p)
+		this.stats.BytesRead += int64(n)
+		this.consumed(p[:n])
+		this.setErr(err)
+		return n, err
+	}
+}
+
+// ReadFill reads until p is full or the stream ends, draining the buffered data first and then continuing with
+// the underlying reader in the same call. Unlike Read it does not stop short at the end of the buffered data,
+// which suits copying loops that expect each call to return as much data as possible. Like io.ReadFull it blocks
+// until len(p) bytes have arrived, so it is not suitable for interactive streams where the peer waits for a reply.
+//
+// Parameters:
+//   - p []byte: The slice to read data into.
+//
+// Returns:
+//   - n int: The number of bytes read. This is less than len(p) only if the stream ended or an error occurred.
+//   - err error: nil if any bytes were read before the stream ended, io.EOF if the stream ended before any bytes
+//     were read, or any other error encountered during reading.
+func (this *PeekBuffer) ReadFill(p []byte) (n int, err error) {
+	for empty := 0; n < len(p) && err == nil; {
+		var read int
+		read, err = this.Read(p[n:])
+		n += read
+		if read > 0 {
+			empty = 0
+		} else if empty++; empty >= maxConsecutiveEmptyReads && err == nil {
+			err = io.ErrNoProgress
+		}
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAtLeast is like io.ReadAtLeast on the PeekBuffer: it reads into p until at least min bytes have been read,
+// draining the buffered data first and then continuing with the underlying reader in the same call, so peeked
+// data counts towards min. Each read may fill the rest of p, so more than min bytes can be returned.
+//
+// Parameters:
+//   - p []byte: The slice to read data into.
+//   - min int: The minimum number of bytes to read.
+//
+// Returns:
+//   - n int: The number of bytes read. This is less than min only if an error is returned.
+//   - err error: nil if at least min bytes were read, io.ErrShortBuffer if min is greater than len(p), io.EOF if the
+//     stream ended before any bytes were read, io.ErrUnexpectedEOF if it ended after some but fewer than min bytes,
+//     or any other error encountered during reading.
+func (this *PeekBuffer) ReadAtLeast(p []byte, min int) (n int, err error) {
+	if len(p) < min {
+		return 0, io.ErrShortBuffer
+	}
+	for empty := 0; n < min && err == nil; {
+		var read int
+		read, err = this.Read(p[n:])
+		n += read
+		if read > 0 {
+			empty = 0
+		} else if empty++; empty >= maxConsecutiveEmptyReads && err == nil {
+			err = io.ErrNoProgress
+		}
+	}
+	if n >= min {
+		err = nil
+	} else if n > 0 && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// ReadN reads exactly n bytes into a newly allocated slice, draining the buffered data first. It is the consuming
+// counterpart to PeekFull and saves callers that read small fixed-size fields from sizing a buffer for io.ReadFull.
+// The slice is allocated up front, so n should be bounded before it is taken from untrusted input.
+//
+// Parameters:
+//   - n int: The number of bytes to read.
+//
+// Returns:
+//   - []byte: The bytes read. It is shorter than 'n' only if an error is returned.
+//   - error: nil if n bytes were read, io.EOF if no bytes were available, io.ErrUnexpectedEOF if the stream ended
+//     after some but not all bytes, ErrNegativeSize if n is negative, or any other error encountered during reading.
+func (this *PeekBuffer) ReadN(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, ErrNegativeSize
+	}
+	p := make([]byte, n)
+	read, err := io.ReadFull(this, p)
+	return p[:read], err
+}
+
+// ConsumePeeked consumes the next n bytes, which must already be buffered, for a peek-then-commit workflow:
+// after inspecting the slice returned by Peek, the caller commits the part it has parsed. It never reads from
+// the underlying reader, and nothing is consumed if an error is returned.
+//
+// Parameters:
+//   - n int: The number of buffered bytes to consume.
+//
+// Returns:
+//   - error: ErrNotBuffered if fewer than n bytes are buffered, bufio.ErrNegativeCount if n is negative, otherwise nil.
+func (this *PeekBuffer) ConsumePeeked(n int) error {
+	if n < 0 {
+		return bufio.ErrNegativeCount
 	}
+	if n > this.Buffered() {
+		return ErrNotBuffered
+	}
+	this.advance(n)
+	return nil
+}
+
+// DrainBuffered reads only data that is already buffered, never calling the underlying reader.
+// It lets an event loop service buffered data first and only block on the underlying reader once the buffer is empty.
+//
+// Parameters:
+//   - p []byte: The slice to read data into.
+//
+// Returns:
+//   - n int: The number of bytes read, which is 0 if nothing is buffered.
+func (this *PeekBuffer) DrainBuffered(p []byte) (n int) {
+	n = copy(p, this.buffer[this.head:this.tail])
+	this.advance(n)
+	return n
 }
 
 // ReadByte implements the io.ByteReader interface.
@@ -64,60 +388,343 @@ func (this *PeekBuffer) Read(p []byte) (n int, err error) {
 //   - byte: The byte read.
 //   - error: Any error encountered during reading, or io.EOF if the end of the stream is reached.
 func (this *PeekBuffer) ReadByte() (byte, error) {
-	if len(this.buffer) > 0 {
-		b := this.buffer[0]
-		this.buffer = this.buffer[1:]
+	if this.head+1 < this.tail && len(this.buffer) <= this.retainSize() && this.tee == nil && this.capture == nil {
+		// Fast path for parsers that read byte by byte: consuming one buffered byte from a buffer
+		// that is not drained and too small to compact only needs the bookkeeping of advance
+		b := this.buffer[this.head]
+		this.head++
+		this.offset++
+		this.lastByte = b
+		this.runeSize = 0
+		this.unread = true
 		return b, nil
-	} else {
-		// Fill the buffer up to MinPeekBufferSize if it's empty
-		buf := make([]byte, FillPeekBufferSize)
-		n, err := io.ReadAtLeast(this.reader, buf, 1)
-		if n > 0 {
-			this.buffer = append(this.buffer, buf[:n]...)
-			b := this.buffer[0]
-			this.buffer = this.buffer[1:]
-			return b, nil
+	}
+	return this.readByte()
+}
+
+// readByte implements ReadByte when consuming the byte needs the full bookkeeping of advance,
+// or the buffer must be filled first.
+func (this *PeekBuffer) readByte() (byte, error) {
+	this.unread = false
+	if this.head == this.tail {
+		// Fill the buffer with up to fillSize bytes if it's empty
+		if err := this.fill(1); this.head == this.tail {
+			return 0, err
 		}
-		return 0, err
 	}
+	b := this.buffer[this.head]
+	this.advance(1)
+	this.lastByte = b
+	this.unread = true
+	this.runeSize = 0
+	return b, nil
+}
+
+// UnreadByte implements the io.ByteScanner interface together with ReadByte.
+// It pushes the byte returned by the most recent ReadByte back onto the front of the stream.
+// Only the most recent ReadByte can be undone, and only if no other operation has consumed
+// or pushed back data since; peeking does not prevent UnreadByte.
+//
+// Returns:
+//   - error: ErrInvalidUnreadByte if the previous operation was not a successful ReadByte, otherwise nil.
+func (this *PeekBuffer) UnreadByte() error {
+	if !this.unread || this.runeSize != 0 {
+		return ErrInvalidUnreadByte
+	}
+	this.unread = false
+	this.replace([]byte{this.lastByte})
+	return nil
 }
 
 // Peek allows looking ahead in the stream without consuming the data.
 // It attempts to return up to 'size' bytes from the stream, buffering them if necessary.
 // If less than 'size' bytes are available, it returns as much as possible.
-// The returned slice is only valid until the next Read operation.
+// The returned slice is only valid until the next Read operation, or until a later Peek has to buffer more data.
 // Note: Modifications to the returned slice will affect subsequent Read operations.
+// Peek(0) never reads from the underlying reader and always returns an empty slice and a nil error,
+// so it never blocks and cannot be used to probe for the end of the stream; use EOF for that.
 //
 // Parameters:
 //   - size int: The number of bytes to peek ahead.
 //
 // Returns:
 //   - []byte: A slice containing the peeked data. May be shorter than 'size' if the wrapped stream has less data than requested.
-//             Modifying this slice will modify the internal buffer and affect subsequent Read operations.
-//   - error: Any error encountered during peeking, or nil if successful.
+//     Modifying this slice will modify the internal buffer and affect subsequent Read operations.
+//   - error: Any error encountered during peeking, ErrNegativeSize if size is negative, ErrBufferFull if size exceeds
+//     the maximum buffer size and the buffer is full, io.EOF or io.ErrUnexpectedEOF if the stream ended early and WithStrictEOF is set,
+//     or nil if successful.
 func (this *PeekBuffer) Peek(size int) ([]byte, error) {
+	peeked, err := this.peek(size)
+	if this.strictEOF {
+		err = truncated(peeked, size, err)
+	}
+	return peeked, err
+}
+
+// truncated returns the error for a peek of size bytes that returned peeked and err when a short peek must be
+// reported: io.EOF if no bytes were available, io.ErrUnexpectedEOF if some were, otherwise err.
+func truncated(peeked []byte, size int, err error) error {
+	if err != nil || len(peeked) >= size {
+		return err
+	}
+	if len(peeked) == 0 {
+		return io.EOF
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// peek implements Peek without WithStrictEOF, for methods that interpret a short result themselves.
+func (this *PeekBuffer) peek(size int) ([]byte, error) {
+	if size < 0 {
+		return nil, ErrNegativeSize
+	}
 	var err error
-	need := size - len(this.buffer)
-	if need > 0 {
-		// Round up to the next multiple of FillPeekBufferSize
-		roundedNeed := ((need + FillPeekBufferSize - 1) / FillPeekBufferSize) * FillPeekBufferSize
-		buf := make([]byte, roundedNeed)
-		var n int
-		n, err = io.ReadFull(this.reader, buf)
-		if n > 0 {
-			this.buffer = append(this.buffer, buf[:n]...)
+	if need := this.peekLimit(size) - this.Buffered(); need > 0 {
+		err = this.fill(need)
+	}
+	return this.peeked(size, err)
+}
+
+// PeekAt allows looking ahead at a window deeper in the stream without consuming the data.
+// It buffers offset+size bytes and returns the size bytes starting at offset, which composes with
+// Peek for fields that follow a variable-length prefix. The returned slice is only valid until the next Read operation.
+//
+// Parameters:
+//   - offset int: The offset from the current position at which the window starts.
+//   - size int: The size of the window.
+//
+// Returns:
+//   - []byte: A slice containing the data in the window. May be shorter than 'size', or empty, if the stream ends within or before the window.
+//   - error: io.EOF if the stream ends before the end of the window, ErrNegativeOffset if offset is negative,
+//     ErrNegativeSize if size is negative, or any other error returned by Peek.
+func (this *PeekBuffer) PeekAt(offset, size int) ([]byte, error) {
+	if offset < 0 {
+		return nil, ErrNegativeOffset
+	}
+	if size < 0 {
+		return nil, ErrNegativeSize
+	}
+
+	peeked, err := this.peek(offset + size)
+	if offset > len(peeked) {
+		offset = len(peeked)
+	}
+	if err == nil && len(peeked) < offset+size {
+		err = io.EOF
+	}
+	return peeked[offset:], err
+}
+
+// PeekFull is like Peek but requires exactly size bytes, in the same way io.ReadFull requires a full buffer.
+// It saves callers that decode fixed-size headers from checking the length of the returned slice.
+// The returned slice is only valid until the next Read operation.
+//
+// Parameters:
+//   - size int: The number of bytes to peek ahead.
+//
+// Returns:
+//   - []byte: A slice containing the peeked data. It is shorter than 'size' only if an error is returned.
+//   - error: nil if size bytes were peeked, io.EOF if no bytes were available, io.ErrUnexpectedEOF if the stream
+//     ended after some but not all bytes, or any error returned by Peek.
+func (this *PeekBuffer) PeekFull(size int) ([]byte, error) {
+	peeked, err := this.peek(size)
+	return peeked, truncated(peeked, size, err)
+}
+
+// PeekLimited is like Peek but reads at most maxFill bytes from the underlying reader, however large size is.
+// This bounds the work and memory a single call spends on untrusted input, complementing the maximum buffer size
+// which bounds the buffer as a whole. Data that is already buffered is returned without counting towards maxFill.
+//
+// Parameters:
+//   - size int: The number of bytes to peek ahead.
+//   - maxFill int: The maximum number of bytes to read from the underlying reader.
+//
+// Returns:
+//   - []byte: A slice containing the peeked data. May be shorter than 'size' if the fill limit was reached
+//     or the stream has less data than requested.
+//   - error: ErrFillLimit if maxFill bytes were read without buffering size bytes, otherwise as for Peek.
+func (this *PeekBuffer) PeekLimited(size, maxFill int) ([]byte, error) {
+	if size < 0 {
+		return nil, ErrNegativeSize
+	}
+	need := this.peekLimit(size) - this.Buffered()
+	if need <= 0 {
+		return this.peeked(size, nil)
+	}
+	if maxFill < 0 {
+		maxFill = 0
+	}
+
+	var err error
+	if maxFill > 0 {
+		if need < maxFill {
+			err = this.fillLimited(need, maxFill)
+		} else {
+			err = this.fillLimited(maxFill, maxFill)
 		}
 	}
+	if err == nil && this.Buffered() < this.peekLimit(size) {
+		peeked, _ := this.peeked(size, nil)
+		return peeked, ErrFillLimit
+	}
+	return this.peeked(size, err)
+}
 
-	have := len(this.buffer)
-	if size < have {
-		have = size
+// PeekString is like Peek but returns the peeked data as a string, for comparing text headers.
+// The data is copied, so unlike the slice returned by Peek the string stays valid after later reads.
+//
+// Parameters:
+//   - size int: The number of bytes to peek ahead.
+//
+// Returns:
+//   - string: The peeked data. May be shorter than 'size' if the stream has less data than requested.
+//   - error: Any error returned by Peek.
+func (this *PeekBuffer) PeekString(size int) (string, error) {
+	peeked, err := this.Peek(size)
+	return string(peeked), err
+}
+
+// AppendPeek is like Peek but appends the peeked data to dst instead of returning a view of the internal buffer,
+// in the style of strconv.AppendInt. Callers can reuse a scratch buffer across iterations to control allocation,
+// and the result stays valid after later reads.
+//
+// Parameters:
+//   - dst []byte: The slice to append to.
+//   - size int: The number of bytes to peek ahead.
+//
+// Returns:
+//   - []byte: dst extended by the peeked data, which may be shorter than 'size' if the stream has less data than requested.
+//   - error: Any error returned by Peek.
+func (this *PeekBuffer) AppendPeek(dst []byte, size int) ([]byte, error) {
+	peeked, err := this.Peek(size)
+	return append(dst, peeked...), err
+}
+
+// PeekExact is like PeekFull but copies the peeked data into dst, so callers that decode fixed-size records
+// can reuse their own buffer and branch on the error alone instead of comparing lengths.
+// The copy stays valid after later reads.
+//
+// Parameters:
+//   - size int: The number of bytes to peek ahead.
+//   - dst []byte: The slice to copy the peeked data into. It must have room for size bytes.
+//
+// Returns:
+//   - int: The number of bytes copied into dst. It is less than 'size' only if an error is returned.
+//   - error: nil if exactly size bytes were peeked, io.ErrUnexpectedEOF if the stream ended after some but not all bytes,
+//     io.EOF if no bytes were available, io.ErrShortBuffer if dst is shorter than size, or any error returned by Peek.
+func (this *PeekBuffer) PeekExact(size int, dst []byte) (int, error) {
+	if len(dst) < size {
+		return 0, io.ErrShortBuffer
+	}
+	peeked, err := this.PeekFull(size)
+	return copy(dst, peeked), err
+}
+
+// Available reports whether at least n more bytes can be read from the stream, buffering them so that reading
+// them afterwards never blocks. It states the intent of checking for a complete fixed-size record more clearly
+// than comparing the length returned by Peek.
+//
+// Parameters:
+//   - n int: The number of bytes required.
+//
+// Returns:
+//   - bool: true if n bytes are available, false if the stream ends first.
+//   - error: Any error returned by Peek, such as ErrBufferFull if n exceeds the maximum buffer size, or nil if successful.
+func (this *PeekBuffer) Available(n int) (bool, error) {
+	peeked, err := this.peek(n)
+	if err != nil {
+		return false, err
+	}
+	return len(peeked) >= n, nil
+}
+
+// EOF reports whether the stream is exhausted, without consuming anything. If no data is buffered it peeks one byte,
+// which blocks until a byte arrives or the stream ends, and any byte it reads stays buffered for the next read.
+//
+// Returns:
+//   - bool: true if no data is buffered and the underlying reader is at the end of the stream, false if at least
+//     one byte can be read.
+//   - error: Any error other than io.EOF returned by the underlying reader when nothing could be read, or nil.
+func (this *PeekBuffer) EOF() (bool, error) {
+	if this.head < this.tail {
+		return false, nil
+	}
+	peeked, err := this.peek(1)
+	if len(peeked) > 0 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
+	return true, nil
+}
+
+// HasPrefix reports whether the stream starts with prefix, without consuming any data.
+//
+// Parameters:
+//   - prefix []byte: The bytes to compare with the start of the stream.
+//
+// Returns:
+//   - bool: true if the stream starts with prefix. false if it doesn't, including when the stream is shorter than prefix.
+//   - error: Any error returned by Peek, or nil if successful.
+func (this *PeekBuffer) HasPrefix(prefix []byte) (bool, error) {
+	peeked, err := this.peek(len(prefix))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(peeked, prefix), nil
+}
+
+// PeekMatch reports which of several prefixes the stream starts with, without consuming any data.
+// Only as many bytes as the longest pattern are peeked, and patterns longer than the stream do not match,
+// which makes it a convenient building block for protocol demultiplexers.
+//
+// Parameters:
+//   - patterns [][]byte: The prefixes to compare with the start of the stream, in order of preference.
+//
+// Returns:
+//   - int: The index of the first pattern the stream starts with, or -1 if none match.
+//   - error: ErrBufferFull if the maximum buffer size is too small to decide whether a pattern matches,
+//     any other error returned by Peek, or nil if successful.
+func (this *PeekBuffer) PeekMatch(patterns [][]byte) (int, error) {
+	longest := 0
+	for _, pattern := range patterns {
+		if len(pattern) > longest {
+			longest = len(pattern)
+		}
+	}
+	peeked, err := this.peek(longest)
+	if err != nil && err != ErrBufferFull {
+		return -1, err
+	}
+
+	for i, pattern := range patterns {
+		if bytes.HasPrefix(peeked, pattern) {
+			return i, nil
+		}
+		if err == ErrBufferFull && bytes.HasPrefix(pattern, peeked) {
+			// The pattern could still match data beyond the maximum buffer size
+			return -1, err
+		}
+	}
+	return -1, nil
+}
 
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return this.buffer[:have], err
+// Expect consumes prefix from the stream if, and only if, the stream starts with it.
+// If the stream does not start with prefix, including when the stream is shorter than prefix, nothing is consumed.
+//
+// Parameters:
+//   - prefix []byte: The bytes expected at the start of the stream.
+//
+// Returns:
+//   - bool: true if the stream started with prefix and it was consumed.
+//   - error: Any error returned by Peek, or nil if successful.
+func (this *PeekBuffer) Expect(prefix []byte) (bool, error) {
+	ok, err := this.HasPrefix(prefix)
+	if ok {
+		this.advance(len(prefix))
 	}
-	return this.buffer[:have], nil
+	return ok, err
 }
 
 // PeekByte allows looking ahead in the stream at a specific offset without consuming the data.
@@ -128,9 +735,13 @@ func (this *PeekBuffer) Peek(size int) ([]byte, error) {
 //
 // Returns:
 //   - byte: The byte at the specified offset.
-//   - error: Any error encountered during peeking, or io.EOF if the end of the stream is reached.
+//   - error: Any error encountered during peeking, io.EOF if the end of the stream is reached,
+//     or ErrNegativeOffset if offset is negative.
 func (this *PeekBuffer) PeekByte(offset int) (byte, error) {
-	peeked, err := this.Peek(offset + 1)
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	peeked, err := this.peek(offset + 1)
 	if err != nil {
 		return 0, err
 	}
@@ -139,3 +750,1536 @@ func (this *PeekBuffer) PeekByte(offset int) (byte, error) {
 	}
 	return peeked[offset], nil
 }
+
+// ByteAt returns the byte at offset i from the current position if it is already buffered, without ever
+// reading from the underlying reader. It is a cheap accessor for tight lookahead loops that have already
+// buffered their input with Fill or EnsureBuffered; if it reports false the caller decides whether to fill.
+//
+// Parameters:
+//   - i int: The offset from the current position of the byte to return.
+//
+// Returns:
+//   - byte: The byte at offset i, or 0 if it is not buffered.
+//   - bool: true if the byte is buffered, false if it is not or if i is negative.
+func (this *PeekBuffer) ByteAt(i int) (byte, bool) {
+	if uint(i) >= uint(this.tail-this.head) {
+		return 0, false
+	}
+	return this.buffer[this.head+i], true
+}
+
+// Discard skips the next n bytes without returning them.
+// It consumes bytes from the internal buffer first, then reads and drops the remaining bytes from the underlying reader.
+// Unlike reading into a throwaway slice, Discard does not allocate a buffer for the skipped data.
+//
+// Parameters:
+//   - n int: The number of bytes to skip.
+//
+// Returns:
+//   - discarded int: The number of bytes actually skipped. This is less than n only if an error occurred.
+//   - err error: io.EOF if no bytes were skipped because the stream ended, io.ErrUnexpectedEOF if the stream ended
+//     after some but not all bytes were skipped, bufio.ErrNegativeCount if n is negative, or any other error
+//     encountered while reading.
+func (this *PeekBuffer) Discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, bufio.ErrNegativeCount
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	discarded = this.Buffered()
+	if n < discarded {
+		discarded = n
+	}
+	this.advance(discarded)
+
+	if discarded < n {
+		if err = this.awaitPending(); err == nil {
+			skipped := this.Buffered()
+			if skipped > n-discarded {
+				skipped = n - discarded
+			}
+			this.advance(skipped)
+			discarded += skipped
+		}
+	}
+
+	for discarded < n && err == nil && (this.retaining() || this.tee != nil || this.capture != nil) {
+		// Consumed bytes must be retained, teed or captured, so discard through the buffer
+		if err = this.fill(1); this.head < this.tail {
+			skipped := this.Buffered()
+			if skipped > n-discarded {
+				skipped = n - discarded
+			}
+			this.advance(skipped)
+			discarded += skipped
+		}
+	}
+
+	if discarded < n && err == nil && this.err != nil {
+		err = this.err
+	} else if discarded < n && err == nil {
+		var skipped int64
+		if err = this.applyDeadline(); err == nil {
+			skipped, err = io.CopyN(io.Discard, this.reader, int64(n-discarded))
+		}
+		discarded += int(skipped)
+		this.offset += skipped
+		this.stats.BytesRead += skipped
+		this.setErr(err)
+	}
+
+	if err == io.EOF && discarded > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return discarded, err
+}
+
+// SkipFunc consumes the leading run of bytes for which pred returns true, such as whitespace or padding.
+// The first byte that does not match is left in place, so it can be peeked or read next.
+// Matched bytes are consumed as each chunk is searched, so a long run does not grow the buffer.
+//
+// Parameters:
+//   - pred func(byte) bool: Reports whether a byte should be skipped.
+//
+// Returns:
+//   - skipped int: The number of bytes skipped.
+//   - err error: nil if a byte that does not match was found, io.EOF if the stream ended first,
+//     or any other error encountered while reading.
+func (this *PeekBuffer) SkipFunc(pred func(byte) bool) (skipped int, err error) {
+	return this.search(func(data []byte) int {
+		for i, b := range data {
+			if !pred(b) {
+				return i
+			}
+		}
+		return -1
+	}, true)
+}
+
+// DiscardUntil skips everything up to and including the first occurrence of delim, for example to resynchronize
+// on the next record boundary after a corrupt frame. Data is dropped as each chunk is searched, so skipping a long
+// run does not grow the buffer or allocate.
+//
+// Parameters:
+//   - delim byte: The delimiter to skip past.
+//
+// Returns:
+//   - discarded int: The number of bytes skipped, including delim.
+//   - err error: nil if delim was found, io.EOF if the stream ended first, or any other error encountered while reading.
+func (this *PeekBuffer) DiscardUntil(delim byte) (discarded int, err error) {
+	return this.search(func(data []byte) int {
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1
+		}
+		return -1
+	}, true)
+}
+
+// CopyN copies the next n bytes of the stream to w, such as a fixed-length body after a sniffed header.
+// Buffered data is written to w directly, then the rest is copied from the underlying reader, which avoids
+// the short reads that io.CopyN would make through Read at the end of the buffered data.
+// Like io.CopyN it stops early if the stream ends or w returns an error.
+//
+// Parameters:
+//   - w io.Writer: The writer to copy to.
+//   - n int64: The number of bytes to copy.
+//
+// Returns:
+//   - written int64: The number of bytes copied. This is less than n only if an error occurred.
+//   - err error: io.EOF if the stream ended after fewer than n bytes, any error returned by w,
+//     or any other error encountered while reading.
+func (this *PeekBuffer) CopyN(w io.Writer, n int64) (written int64, err error) {
+	if n <= 0 {
+		return 0, nil
+	}
+
+	for written < n && err == nil {
+		if err = this.awaitPending(); err != nil {
+			break
+		}
+		if this.head == this.tail {
+			if !this.retaining() && this.tee == nil && this.capture == nil {
+				break
+			} else if err = this.fillMore(); this.head == this.tail {
+				// Consumed bytes must be retained, teed or captured, so copy through the buffer
+				break
+			}
+		}
+		chunk := this.buffer[this.head:this.tail]
+		if int64(len(chunk)) > n-written {
+			chunk = chunk[:n-written]
+		}
+		m, werr := w.Write(chunk)
+		this.advance(m)
+		written += int64(m)
+		if werr == nil && m < len(chunk) {
+			werr = io.ErrShortWrite
+		}
+		if werr != nil {
+			return written, werr
+		}
+	}
+
+	if written < n && err == nil && this.err != nil {
+		err = this.err
+	} else if written < n && err == nil {
+		if err = this.applyDeadline(); err == nil {
+			reader := &errorRecorder{reader: this.reader}
+			var copied int64
+			copied, err = io.CopyN(w, reader, n-written)
+			written += copied
+			this.offset += copied
+			this.stats.BytesRead += copied
+			this.setErr(reader.err)
+		}
+	}
+
+	if err == nil && written < n {
+		err = io.EOF
+	}
+	return written, err
+}
+
+// WriteTo implements the io.WriterTo interface, so io.Copy from a PeekBuffer writes the buffered data directly
+// and then copies the rest of the stream from the underlying reader, as CopyN does.
+//
+// Parameters:
+//   - w io.Writer: The writer to copy to.
+//
+// Returns:
+//   - n int64: The number of bytes written.
+//   - err error: nil once the end of the stream has been reached, otherwise any error encountered while reading or writing.
+func (this *PeekBuffer) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = this.CopyN(w, math.MaxInt64)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Size returns the fill size, which is the amount read from the underlying reader at a time.
+// It corresponds to the buffer size of a bufio.Reader, but the internal buffer grows beyond it when a peek needs more.
+//
+// Returns:
+//   - int: The fill size in bytes.
+func (this *PeekBuffer) Size() int {
+	return this.fillSize
+}
+
+// Reset discards any buffered data and switches the PeekBuffer to read from a new reader.
+// The internal buffer is truncated rather than freed so its backing array can be reused,
+// which makes it practical to keep PeekBuffers in a sync.Pool and Reset them between streams.
+// No data buffered from the previous reader is visible after Reset.
+//
+// Parameters:
+//   - reader io.Reader: The new underlying reader to wrap.
+func (this *PeekBuffer) Reset(reader io.Reader) {
+	this.reader = reader
+	this.head = 0
+	this.tail = 0
+	this.pending = nil
+	this.err = nil
+	this.eof = false
+	this.offset = 0
+	this.marked = false
+	this.unread = false
+	this.snapshots = this.snapshots[:0]
+	this.origin = 0
+	this.captureFrom = 0
+	this.deadline = time.Time{}
+	this.stats = Stats{}
+}
+
+// ResetKeepBuffer switches the PeekBuffer to read from a new reader, keeping the buffered data.
+// Unlike Reset, subsequent reads return the bytes already buffered from the previous reader before any data from
+// the new one, which suits a session that reconnects its transport but must not lose lookahead it already peeked.
+// Any error remembered from the previous reader is cleared, and a read left in flight on it by PeekContext is
+// abandoned. Offset, any mark and any snapshots are kept.
+//
+// Parameters:
+//   - reader io.Reader: The new underlying reader to wrap.
+func (this *PeekBuffer) ResetKeepBuffer(reader io.Reader) {
+	this.reader = reader
+	this.pending = nil
+	this.err = nil
+	this.eof = false
+}
+
+// Buffered returns the number of bytes that have been peeked but not yet read.
+// These bytes are served from the internal buffer without touching the underlying reader,
+// so a Peek of at most Buffered() bytes never blocks.
+//
+// Returns:
+//   - int: The number of bytes currently held in the internal buffer.
+func (this *PeekBuffer) Buffered() int {
+	return this.tail - this.head
+}
+
+// Peeked returns all data that has been peeked but not yet read, without reading from the underlying reader.
+// It is equivalent to Peek(Buffered()). The returned slice is a view into the internal buffer like the one returned
+// by Peek: it is only valid until the next Read operation, and modifying it affects subsequent reads.
+//
+// Returns:
+//   - []byte: A slice containing the buffered data, empty if nothing is buffered.
+func (this *PeekBuffer) Peeked() []byte {
+	return this.buffer[this.head:this.tail]
+}
+
+// History returns the most recently consumed bytes retained by WithHistory, oldest first, for parsers that need
+// a little look-behind such as checking whether the previous byte was an escape character. It never reads from
+// the underlying reader. The history holds fewer bytes at the start of the stream and is emptied by Reset and Seek;
+// after Unread, Rewind or Restore it holds the bytes consumed before the new position. The returned slice is a view
+// into the internal buffer: it is only valid until the next Read operation, and must not be modified.
+//
+// Returns:
+//   - []byte: Up to the configured number of consumed bytes, or an empty slice if WithHistory was not used.
+func (this *PeekBuffer) History() []byte {
+	start := this.head - this.historySize
+	if start < 0 {
+		start = 0
+	}
+	return this.buffer[start:this.head]
+}
+
+// Buffers returns the buffered data as net.Buffers without consuming it, so it can be flushed with a vectored write
+// such as net.Buffers.WriteTo, followed by Discard for the number of bytes written. The buffered data is always
+// contiguous, so there is at most one segment, but callers should not rely on that. Like the slice returned by Peek,
+// each segment is a view into the internal buffer: it is only valid until the next Read operation, or until a later
+// Peek has to buffer more data, and modifying it affects subsequent reads. Writing the result consumes the returned
+// net.Buffers value, not the PeekBuffer.
+//
+// Returns:
+//   - net.Buffers: The buffered data in order, or nil if nothing is buffered.
+func (this *PeekBuffer) Buffers() net.Buffers {
+	if this.head == this.tail {
+		return nil
+	}
+	return net.Buffers{this.buffer[this.head:this.tail]}
+}
+
+// String implements the fmt.Stringer interface for debugging.
+// It describes the buffered data and shows the first few buffered bytes in hex and as ASCII,
+// without reading from the underlying reader or consuming anything.
+//
+// Returns:
+//   - string: A description of the buffer, for example
+//     `PeekBuffer{buffered: 5, capacity: 4096, offset: 0, data: 68 65 6c 6c 6f |hello|}`.
+func (this *PeekBuffer) String() string {
+	preview := this.buffer[this.head:this.tail]
+	if len(preview) > stringPreviewLen {
+		preview = preview[:stringPreviewLen]
+	}
+
+	var data strings.Builder
+	for _, b := range preview {
+		fmt.Fprintf(&data, "%02x ", b)
+	}
+	if len(preview) < this.Buffered() {
+		data.WriteString("... ")
+	}
+	data.WriteByte('|')
+	for _, b := range preview {
+		if b < 0x20 || b > 0x7e {
+			b = '.'
+		}
+		data.WriteByte(b)
+	}
+	data.WriteByte('|')
+	return fmt.Sprintf("PeekBuffer{buffered: %d, capacity: %d, offset: %d, data: %s}",
+		this.Buffered(), len(this.buffer), this.offset, data.String())
+}
+
+// DumpBuffered writes a hex dump of the buffered data to w in the format of encoding/hex.Dump, for investigating
+// frames that fail to parse. Unlike String it shows all of the buffered data. It does not read from the underlying
+// reader or consume anything, and the offsets in the dump count from the next byte a Read would return; add Offset
+// for the position in the stream. Nothing is written if nothing is buffered.
+//
+// Parameters:
+//   - w io.Writer: The writer to write the dump to.
+//
+// Returns:
+//   - error: Any error returned by w, otherwise nil.
+func (this *PeekBuffer) DumpBuffered(w io.Writer) error {
+	dumper := hex.Dumper(w)
+	if _, err := dumper.Write(this.buffer[this.head:this.tail]); err != nil {
+		return err
+	}
+	return dumper.Close()
+}
+
+// PeekUntil looks ahead in the stream until the first occurrence of delim without consuming the data.
+// The buffer is filled in chunks of up to the fill size until delim is found, the stream ends or the
+// maximum buffer size is reached. The returned slice is only valid until the next Read operation.
+//
+// Parameters:
+//   - delim byte: The delimiter to search for.
+//
+// Returns:
+//   - []byte: A slice of the buffered data up to and including delim, or all buffered data if delim was not found.
+//   - error: nil if delim was found, io.EOF if the stream ended first, ErrBufferFull if the maximum buffer size
+//     was reached first, or any other error encountered while reading.
+func (this *PeekBuffer) PeekUntil(delim byte) ([]byte, error) {
+	n, err := this.scan(func(data []byte) int {
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1
+		}
+		return -1
+	})
+	return this.buffer[this.head : this.head+n], err
+}
+
+// PeekUntilFunc looks ahead in the stream until the first byte for which pred returns true, without consuming the data.
+// It generalizes PeekUntil to classes of bytes, such as the first non-whitespace or control character.
+// The buffer is filled in chunks of up to the fill size and pred is called at most once for each byte.
+// The returned slice is only valid until the next Read operation.
+//
+// Parameters:
+//   - pred func(byte) bool: Reports whether a byte ends the peek.
+//
+// Returns:
+//   - []byte: A slice of the buffered data up to but not including the first byte matching pred,
+//     or all buffered data if no byte matched.
+//   - error: nil if a byte matched, io.EOF if the stream ended first, ErrBufferFull if the maximum buffer size
+//     was reached first, or any other error encountered while reading.
+func (this *PeekBuffer) PeekUntilFunc(pred func(byte) bool) ([]byte, error) {
+	n, err := this.scan(func(data []byte) int {
+		for i, b := range data {
+			if pred(b) {
+				return i
+			}
+		}
+		return -1
+	})
+	return this.buffer[this.head : this.head+n], err
+}
+
+// PeekDelimited peeks a balanced region that starts with the open delimiter at the next byte and ends at the
+// matching close delimiter, counting nested pairs, for parsing bracketed formats without consuming the data.
+// If open and close are the same byte the region ends at its next occurrence, as for quoted strings.
+// Delimiters are matched as raw bytes; escapes and quoting within the region are not interpreted.
+// The returned slice is only valid until the next Read operation.
+//
+// Parameters:
+//   - open byte: The delimiter that opens a region, which must be the next byte.
+//   - close byte: The delimiter that closes a region.
+//
+// Returns:
+//   - []byte: A slice containing the balanced region including both outer delimiters,
+//     or all buffered data if the region was not closed.
+//   - error: nil if the region was closed, ErrNotDelimited if the next byte is not open, io.EOF if the stream
+//     has no more data, io.ErrUnexpectedEOF if it ended within the region, ErrBufferFull if the maximum buffer
+//     size was reached first, or any other error encountered while reading.
+func (this *PeekBuffer) PeekDelimited(open, close byte) ([]byte, error) {
+	depth := 0
+	n, err := this.scan(func(data []byte) int {
+		for i, b := range data {
+			if b == close && depth > 0 {
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			} else if b == open {
+				depth++
+			} else if depth == 0 {
+				return 0
+			}
+		}
+		return -1
+	})
+	if err == nil && n == 0 {
+		return nil, ErrNotDelimited
+	}
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return this.buffer[this.head : this.head+n], err
+}
+
+// PeekAll reads the rest of the underlying stream into the internal buffer without consuming it.
+// Subsequent reads replay the entire buffered content, so the stream can be inspected several times and then
+// handed on untouched. The caller opts into holding the whole stream in memory; only a maximum buffer size
+// configured with SetMaxBuffer limits how much is buffered. The returned slice is only valid until the next Read operation.
+//
+// Returns:
+//   - []byte: A slice containing all remaining data in the stream.
+//   - error: nil once the end of the stream has been reached, ErrBufferFull if the maximum buffer size was reached first,
+//     or any other error encountered while reading.
+func (this *PeekBuffer) PeekAll() ([]byte, error) {
+	n, err := this.scan(func([]byte) int { return -1 })
+	if err == io.EOF {
+		err = nil
+	}
+	return this.buffer[this.head : this.head+n], err
+}
+
+// ReadSlice reads until the first occurrence of delim in the input, returning a slice pointing at the bytes in the buffer.
+// It behaves like bufio.Reader.ReadSlice: the bytes stop being valid at the next read, and if delim is not found
+// before the stream ends or the maximum buffer size is reached, all buffered data is consumed and returned with an error.
+// Because the buffer grows as needed, ErrBufferFull is only returned when a maximum buffer size is configured.
+//
+// Parameters:
+//   - delim byte: The delimiter to search for.
+//
+// Returns:
+//   - line []byte: A slice of the internal buffer up to and including delim.
+//   - err error: nil if and only if line ends in delim, io.EOF if the stream ended first, ErrBufferFull if the
+//     maximum buffer size was reached first, or any other error encountered while reading.
+func (this *PeekBuffer) ReadSlice(delim byte) (line []byte, err error) {
+	line, err = this.PeekUntil(delim)
+	this.advance(len(line))
+	return line, err
+}
+
+// ReadBytes reads until the first occurrence of delim in the input, returning a newly allocated slice containing
+// the data up to and including delim. Unlike ReadSlice, the result remains valid after later reads and may be longer
+// than the maximum buffer size.
+//
+// Parameters:
+//   - delim byte: The delimiter to search for.
+//
+// Returns:
+//   - []byte: The data read, up to and including delim, or all remaining data if delim was not found.
+//   - error: nil if and only if the returned data ends in delim, io.EOF if the stream ended first, or any other error encountered while reading.
+func (this *PeekBuffer) ReadBytes(delim byte) ([]byte, error) {
+	var result []byte
+	for {
+		line, err := this.ReadSlice(delim)
+		result = append(result, line...)
+		if err != ErrBufferFull {
+			return result, err
+		}
+	}
+}
+
+// ReadString reads until the first occurrence of delim in the input, returning a string containing the data up to and including delim.
+// Peeked data is returned before data from the underlying reader. Unlike ReadSlice, the line may be longer than the maximum buffer size.
+//
+// Parameters:
+//   - delim byte: The delimiter to search for.
+//
+// Returns:
+//   - string: The data read, up to and including delim, or all remaining data if delim was not found.
+//   - error: nil if and only if the returned data ends in delim, io.EOF if the stream ended first, or any other error encountered while reading.
+func (this *PeekBuffer) ReadString(delim byte) (string, error) {
+	var builder strings.Builder
+	for {
+		line, err := this.ReadSlice(delim)
+		builder.Write(line)
+		if err != ErrBufferFull {
+			return builder.String(), err
+		}
+	}
+}
+
+// ReadLine reads a single line, not including the end-of-line bytes, with the same semantics as bufio.Reader.ReadLine.
+// Lines may end in either "\n" or "\r\n". If the line is longer than the maximum buffer size, isPrefix is set and
+// the beginning of the line is returned; the rest of the line is returned by subsequent calls. A "\r" at the end of
+// a full buffer is left in place so that a "\r\n" split across calls is still recognised as a line ending.
+// The returned slice is only valid until the next Read operation.
+//
+// Returns:
+//   - line []byte: The line read, without the trailing "\n" or "\r\n".
+//   - isPrefix bool: true if the line was too long for the buffer and only its beginning was returned.
+//   - err error: nil if a line was returned, otherwise io.EOF at the end of the stream or any other error encountered while reading.
+func (this *PeekBuffer) ReadLine() (line []byte, isPrefix bool, err error) {
+	line, err = this.PeekUntil('\n')
+	if err == ErrBufferFull {
+		// Leave a trailing '\r' buffered so the next call can check for "\r\n".
+		if len(line) > 1 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		this.advance(len(line))
+		return line, true, nil
+	}
+	this.advance(len(line))
+
+	if len(line) == 0 {
+		if err != nil {
+			line = nil
+		}
+		return line, false, err
+	}
+	err = nil
+
+	if line[len(line)-1] == '\n' {
+		drop := 1
+		if len(line) > 1 && line[len(line)-2] == '\r' {
+			drop = 2
+		}
+		line = line[:len(line)-drop]
+	}
+	return line, false, nil
+}
+
+// Lines calls yield for each line in the stream, without the trailing "\n" or "\r\n", until yield returns false
+// or the stream ends. Each line is a view into the internal buffer rather than a copy, so the loop does not allocate,
+// but the slice is only valid during the call to yield that receives it and yield must not call methods of the
+// PeekBuffer. A line is consumed once yield returns, including the line for which yield returns false.
+// The shape matches a Go 1.23 iterator, except that an error is returned once iteration stops.
+//
+// Parameters:
+//   - yield func(line []byte) bool: Called with each line; returns false to stop iterating.
+//
+// Returns:
+//   - error: nil if the stream ended or yield stopped the iteration, ErrBufferFull if a line is longer than
+//     the maximum buffer size, or any other error encountered while reading.
+func (this *PeekBuffer) Lines(yield func(line []byte) bool) error {
+	for {
+		line, err := this.PeekUntil('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+
+		n := len(line)
+		if line[n-1] == '\n' {
+			line = line[:n-1]
+			if len(line) > 0 && line[len(line)-1] == '\r' {
+				line = line[:len(line)-1]
+			}
+		}
+		more := yield(line)
+		this.advance(n)
+		if !more || err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// ReadRune implements the io.RuneReader interface.
+// It reads a single UTF-8 encoded rune, returning the rune and its size in bytes, like bufio.Reader.ReadRune.
+// If the encoded rune is invalid, it consumes one byte and returns utf8.RuneError with a size of 1.
+//
+// Returns:
+//   - r rune: The rune read.
+//   - size int: The number of bytes consumed.
+//   - err error: Any error encountered during reading, or io.EOF if the end of the stream is reached.
+func (this *PeekBuffer) ReadRune() (r rune, size int, err error) {
+	r, size, err = this.PeekRune()
+	copy(this.lastRune[:], this.buffer[this.head:this.head+size])
+	this.advance(size)
+	this.unread = size > 0
+	this.runeSize = size
+	return r, size, err
+}
+
+// UnreadRune pushes the rune returned by the most recent ReadRune back onto the front of the stream,
+// like bufio.Reader.UnreadRune. Only the most recent ReadRune can be undone, and only if no other operation
+// has consumed or pushed back data since; peeking does not prevent UnreadRune.
+//
+// Returns:
+//   - error: ErrInvalidUnreadRune if the previous operation was not a successful ReadRune, otherwise nil.
+func (this *PeekBuffer) UnreadRune() error {
+	if !this.unread || this.runeSize == 0 {
+		return ErrInvalidUnreadRune
+	}
+	this.unread = false
+	this.replace(this.lastRune[:this.runeSize])
+	return nil
+}
+
+// PeekRune decodes the next UTF-8 encoded rune without consuming it.
+// It buffers up to utf8.UTFMax bytes, so runes that straddle a fill boundary are decoded correctly.
+// If the encoded rune is invalid, it returns utf8.RuneError with a size of 1.
+//
+// Returns:
+//   - r rune: The next rune in the stream.
+//   - size int: The encoded size of the rune in bytes.
+//   - err error: Any error encountered during peeking, or io.EOF if the end of the stream is reached.
+func (this *PeekBuffer) PeekRune() (r rune, size int, err error) {
+	return this.PeekRuneAt(0)
+}
+
+// PeekRuneAt decodes the UTF-8 encoded rune that starts offset bytes ahead in the stream, without consuming anything.
+// It buffers up to utf8.UTFMax bytes past offset, so runes that straddle a fill boundary are decoded correctly,
+// which lets tokenizers index into the lookahead window by byte offset.
+// If the encoded rune is invalid, it returns utf8.RuneError with a size of 1.
+//
+// Parameters:
+//   - offset int: The offset in bytes from the current position at which the rune starts.
+//
+// Returns:
+//   - r rune: The rune at offset.
+//   - size int: The encoded size of the rune in bytes.
+//   - err error: ErrNegativeOffset if offset is negative, io.EOF if the stream ends at or before offset,
+//     or any other error encountered during peeking.
+func (this *PeekBuffer) PeekRuneAt(offset int) (r rune, size int, err error) {
+	if offset < 0 {
+		return 0, 0, ErrNegativeOffset
+	}
+	var peeked []byte
+	if offset < this.Buffered() {
+		peeked = this.buffer[this.head+offset : this.tail]
+	}
+	for len(peeked) < utf8.UTFMax && !utf8.FullRune(peeked) {
+		have := len(peeked)
+		all, peekErr := this.peek(offset + have + 1)
+		if err = peekErr; len(all) > offset {
+			peeked = all[offset:]
+		}
+		if err != nil || len(peeked) == have {
+			break
+		}
+	}
+
+	if len(peeked) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, 0, err
+	}
+	r, size = utf8.DecodeRune(peeked)
+	return r, size, nil
+}
+
+// Unread pushes previously read bytes back onto the front of the stream.
+// The next Read or Peek returns the bytes of p, in order, before any data that was already buffered,
+// which allows a parser to roll back after speculatively consuming input. The bytes are copied,
+// so p may be reused after Unread returns. Offset moves back by len(p).
+// p takes the place of the last len(p) consumed bytes: if a mark is active, Rewind replays the bytes consumed
+// between the mark and those bytes followed by p, which is the original stream when p holds the bytes that were
+// read. A mark set within the replaced bytes moves back to the start of p.
+//
+// Parameters:
+//   - p []byte: The bytes to push back.
+//
+// Returns:
+//   - error: ErrBufferFull if pushing back p would exceed the maximum buffer size, otherwise nil.
+func (this *PeekBuffer) Unread(p []byte) error {
+	if this.maxSize > 0 && this.Buffered()+len(p) > this.maxSize {
+		return ErrBufferFull
+	}
+	this.replace(p)
+	return nil
+}
+
+// Prepend injects synthetic bytes at the front of the stream, for framing code that rewrites a header it has
+// consumed or splices in data that never came from the underlying reader. The next Read or Peek returns the bytes
+// of p, in order, before any data that was already buffered, and a later Prepend goes in front of an earlier one.
+// The bytes are copied, so p may be reused after Prepend returns.
+// Unlike Unread it never fails: p is buffered even if that exceeds the maximum buffer size, in which case
+// Peek can see all of it but reports ErrBufferFull for anything beyond until enough has been consumed.
+// Offset moves back by len(p), so once the injected bytes have been consumed it again reports the position
+// in the underlying stream. Unlike Unread, p does not replace consumed bytes: Rewind, Restore and RewindAll
+// replay the bytes consumed before p followed by p, and History still holds them. Offset after returning to a
+// position before p is likewise len(p) less than it was there.
+//
+// Parameters:
+//   - p []byte: The bytes to inject.
+func (this *PeekBuffer) Prepend(p []byte) {
+	this.insert(p)
+}
+
+// Close implements the io.Closer interface.
+// It closes the underlying reader if it implements io.Closer, so a PeekBuffer wrapping a net.Conn
+// or an http.Request body can be used wherever an io.ReadCloser is expected.
+//
+// Returns:
+//   - error: The error returned by the underlying reader's Close method, or nil if it is not an io.Closer.
+func (this *PeekBuffer) Close() error {
+	if closer, ok := this.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Unwrap returns the underlying reader, following the errors.Unwrap convention so that middleware
+// can reach the wrapped reader to inspect its concrete type or configure it.
+// Data that has already been buffered is not visible through the returned reader, so reading from it
+// directly skips those bytes and leaves the PeekBuffer out of step with the stream.
+//
+// Returns:
+//   - io.Reader: The underlying reader.
+func (this *PeekBuffer) Unwrap() io.Reader {
+	return this.reader
+}
+
+// Detach returns an independent reader that replays the buffered data followed by the rest of the underlying
+// reader, for handing the stream to a third-party parser after sniffing it. Unlike Unwrap no buffered bytes are
+// lost. The buffered data is copied, so the returned reader stays valid whatever happens to the PeekBuffer, but
+// the underlying reader is shared: after Detach the PeekBuffer must not be used for reads, although methods that
+// do not read, such as Offset, Stats and Close, still work. Reads from the returned reader do not go through the
+// PeekBuffer, so they are not teed, captured, counted or subject to the deadline set by SetDeadline.
+// If the underlying reader already failed, the returned reader reports that error after the buffered data instead
+// of reading again.
+//
+// Returns:
+//   - io.Reader: A reader for the buffered data and the rest of the stream.
+func (this *PeekBuffer) Detach() io.Reader {
+	if this.pending != nil {
+		// The error is remembered by collect and reported below
+		this.collect()
+	}
+	buffered := bytes.NewReader(append([]byte(nil), this.buffer[this.head:this.tail]...))
+	if this.err != nil {
+		return io.MultiReader(buffered, &errReader{err: this.err})
+	}
+	return io.MultiReader(buffered, this.reader)
+}
+
+// Seek implements the io.Seeker interface by delegating to the underlying reader, which must implement io.Seeker.
+// Offsets relative to io.SeekCurrent are measured from the next byte a Read would return, not from the position of
+// the underlying reader, which is ahead by the number of buffered bytes. After a successful seek the buffered data
+// is discarded, any mark or snapshot is cleared, a recording restarts at the new position, and Offset reports the new
+// absolute position. If the seek fails the PeekBuffer is left unchanged.
+//
+// Parameters:
+//   - offset int64: The offset to seek to, interpreted according to whence.
+//   - whence int: io.SeekStart, io.SeekCurrent or io.SeekEnd.
+//
+// Returns:
+//   - int64: The new offset relative to the start of the underlying reader.
+//   - error: ErrNotSeeker if the underlying reader is not an io.Seeker, or any error returned by its Seek method.
+func (this *PeekBuffer) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := this.reader.(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeeker
+	}
+	if this.pending != nil {
+		// The data is dropped below, but a read error is still remembered
+		this.collect()
+	}
+	if whence == io.SeekCurrent {
+		offset -= int64(this.Buffered())
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	this.head = 0
+	this.tail = 0
+	this.eof = false
+	this.offset = pos
+	this.marked = false
+	this.unread = false
+	this.snapshots = this.snapshots[:0]
+	this.origin = 0
+	return pos, nil
+}
+
+// ReadAt implements io.ReaderAt over the buffered window of the stream, for formats that need random access
+// within a bounded prefix. off is an absolute position in the stream, as returned by Offset. Data from Offset onwards
+// is peeked, buffering the stream up to off+len(p), so it stays available to later reads. Data before Offset has been
+// consumed and can only be read while it is still retained in the buffer, such as after a Mark.
+// Unlike a general io.ReaderAt it is therefore forward-only, and must not be called concurrently with other methods.
+// Reading far ahead buffers everything up to the end of the read, subject to the maximum buffer size.
+//
+// Parameters:
+//   - p []byte: The buffer to read into.
+//   - off int64: The absolute offset in the stream to read from.
+//
+// Returns:
+//   - int: The number of bytes read into p.
+//   - error: nil if p was filled, io.EOF if the stream ended first, ErrNegativeOffset if off is negative,
+//     ErrOffsetConsumed if off is before the retained data, or any error returned by Peek.
+func (this *PeekBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrNegativeOffset
+	}
+	rel := off - this.offset
+	if rel < -int64(this.head-this.keep()) {
+		return 0, ErrOffsetConsumed
+	}
+
+	var err error
+	if end := rel + int64(len(p)); end > 0 {
+		_, err = this.peek(int(end))
+	}
+	start := this.head + int(rel)
+	if start > this.tail {
+		start = this.tail
+	}
+	n := copy(p, this.buffer[start:this.tail])
+	if n < len(p) && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// IsPeekBuffer reports that the reader is a PeekBuffer. It always returns true; it exists so that code holding
+// an io.Reader can detect a PeekBuffer, or a type embedding one such as PeekConn, with an interface assertion.
+//
+// Returns:
+//   - bool: true.
+func (this *PeekBuffer) IsPeekBuffer() bool {
+	return true
+}
+
+// Innermost returns the reader at the bottom of a stack of PeekBuffers, following Unwrap through every
+// underlying reader that is itself a PeekBuffer. As with Unwrap, data buffered by any of the PeekBuffers
+// is not visible through the returned reader.
+//
+// Returns:
+//   - io.Reader: The first underlying reader that is not a PeekBuffer.
+func (this *PeekBuffer) Innermost() io.Reader {
+	reader := this.reader
+	for {
+		pb, ok := reader.(interface {
+			IsPeekBuffer() bool
+			Unwrap() io.Reader
+		})
+		if !ok || !pb.IsPeekBuffer() {
+			return reader
+		}
+		reader = pb.Unwrap()
+	}
+}
+
+// Fill prefetches data from the underlying reader until at least min bytes are buffered or the stream ends,
+// so that later Peek and Read calls of up to min bytes are served from the buffer without touching the reader.
+// It is equivalent to Peek(min) without returning the data.
+//
+// Parameters:
+//   - min int: The number of bytes to buffer.
+//
+// Returns:
+//   - error: nil if min bytes were buffered or the stream ended first, ErrBufferFull if min exceeds the maximum
+//     buffer size, or any other error encountered while reading.
+func (this *PeekBuffer) Fill(min int) error {
+	_, err := this.peek(min)
+	return err
+}
+
+// EnsureBuffered reads until at least n bytes are buffered, treating a stream that ends first as an error.
+// It is the precondition check for fixed-layout parsing: unlike Fill a short stream is an error, and unlike
+// PeekFull no slice is returned, so the fields can then be decoded with Peek, PeekAt or PeekByte.
+//
+// Parameters:
+//   - n int: The number of bytes that must be buffered.
+//
+// Returns:
+//   - error: nil once n bytes are buffered, io.ErrUnexpectedEOF if the stream ended first, even with no bytes
+//     buffered, or any other error returned by PeekFull.
+func (this *PeekBuffer) EnsureBuffered(n int) error {
+	_, err := this.PeekFull(n)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Grow ensures the internal buffer has room for at least n more buffered bytes, analogous to bytes.Buffer.Grow.
+// It lets callers that know how far they will peek allocate once up front instead of growing the buffer in
+// fill size steps. It does not read from the underlying reader or change the buffered data, and it never grows
+// the buffer beyond the maximum buffer size. The backing array is kept at that size once the buffer is drained,
+// rather than released like an array grown by a large peek, until CompactBuffer is called.
+//
+// Parameters:
+//   - n int: The number of additional bytes to make room for.
+//
+// Panics if n is negative.
+func (this *PeekBuffer) Grow(n int) {
+	if n < 0 {
+		panic("peekbuffer: negative count")
+	}
+	if this.maxSize > 0 && n > this.maxSize-this.Buffered() {
+		n = this.maxSize - this.Buffered()
+		if n < 0 {
+			n = 0
+		}
+	}
+	this.reserve(n)
+	if len(this.buffer) > this.capacity {
+		this.capacity = len(this.buffer)
+	}
+}
+
+// CompactBuffer copies the buffered data into a right-sized backing array and drops the current one,
+// so a large array left behind by a big peek can be garbage collected. The buffer already releases large arrays
+// once they are drained or mostly consumed; CompactBuffer lets callers reclaim memory at a point of their choosing,
+// at the cost of an allocation and a copy. Bytes retained by Mark or Snapshot are kept.
+// The capacity asked for by Grow or WithInitialCapacity is given up as well.
+func (this *PeekBuffer) CompactBuffer() {
+	this.capacity = 0
+	keep := this.keep()
+	if keep == this.tail {
+		this.buffer = nil
+	} else if this.tail-keep < len(this.buffer) {
+		this.buffer = append([]byte(nil), this.buffer[keep:this.tail]...)
+	} else {
+		return
+	}
+	this.rebase(keep)
+}
+
+// Offset returns the number of bytes consumed from the stream so far, which is the absolute position
+// of the next byte to be read. Bytes count as consumed when they are returned by a read method or skipped
+// by Discard; peeking does not advance the offset. Reset starts counting again from zero.
+//
+// Returns:
+//   - int64: The number of bytes consumed.
+func (this *PeekBuffer) Offset() int64 {
+	return this.offset
+}
+
+// Mark records the current position in the stream so that Rewind can return to it later,
+// like mark in java.io.BufferedInputStream. Calling Mark again replaces the previous mark.
+// While a mark is active every byte consumed after it is retained in the internal buffer,
+// so a mark holds memory proportional to the number of bytes consumed until Rewind or the next Mark.
+// Retained bytes do not count towards the maximum buffer size.
+func (this *PeekBuffer) Mark() {
+	this.mark = this.head
+	this.marked = true
+}
+
+// Rewind returns to the position recorded by Mark, so all bytes consumed since then are read again.
+// The mark is cleared and its retained bytes become ordinary buffered data.
+// Offset moves back to the marked position.
+//
+// Returns:
+//   - error: ErrNoMark if there is no active mark, otherwise nil.
+func (this *PeekBuffer) Rewind() error {
+	if !this.marked {
+		return ErrNoMark
+	}
+	this.offset -= int64(this.head - this.mark)
+	this.head = this.mark
+	this.marked = false
+	this.unread = false
+	return nil
+}
+
+// SetTee mirrors consumed bytes to w, like io.TeeReader.
+// Every byte returned by a read method or skipped by Discard is written to w exactly once when it is consumed,
+// including bytes that were peeked earlier. Peeking does not write anything, because peeked bytes have not been
+// consumed yet. Bytes replayed after Unread or Rewind are written again when they are consumed again.
+// If a write to w fails, teeing stops and the error is returned by later reads like an error from the underlying reader.
+//
+// Parameters:
+//   - w io.Writer: The writer that receives consumed bytes, or nil to stop teeing.
+func (this *PeekBuffer) SetTee(w io.Writer) {
+	this.tee = w
+}
+
+// SetCapture records the first limit bytes consumed from now on to w, such as a file kept for forensic replay,
+// while reads keep being served as usual. Unlike SetTee, each byte of the stream is captured at most once, even if
+// it is read again after Unread or Rewind, and capturing stops for good once limit bytes have been written, which
+// bounds the space a capture can use. A failed write to w also stops capturing but, unlike a failed tee, does not
+// affect reads. Calling SetCapture again replaces the previous capture and starts a new count.
+//
+// Parameters:
+//   - w io.Writer: The writer that receives the captured bytes, or nil to stop capturing.
+//   - limit int: The maximum number of bytes to write to w.
+func (this *PeekBuffer) SetCapture(w io.Writer, limit int) {
+	if limit <= 0 {
+		w = nil
+	}
+	this.capture = w
+	this.captureLeft = limit
+	this.captureFrom = this.offset
+}
+
+// NextToken reads the next token from the stream using split, in the same way as bufio.Scanner.
+// The split function is applied to the buffered data, which grows as the split function requests more,
+// and exactly the number of bytes it advances over is consumed. This allows any bufio.SplitFunc, such as
+// bufio.ScanLines or bufio.ScanWords, to be used without hiding the peek capability behind a bufio.Scanner.
+// The token may be a view into the internal buffer and is only valid until the next Read operation.
+//
+// Parameters:
+//   - split bufio.SplitFunc: The split function that finds the next token.
+//
+// Returns:
+//   - []byte: The next token.
+//   - error: nil if a token was found, io.EOF at the end of the stream, ErrBufferFull if the token is larger than
+//     the maximum buffer size, any error returned by split (together with its token, after consuming its advance),
+//     or any other error encountered while reading.
+func (this *PeekBuffer) NextToken(split bufio.SplitFunc) ([]byte, error) {
+	atEOF := false
+	for {
+		// Like bufio.Scanner, only call split without data at the end of the stream
+		if data := this.buffer[this.head:this.tail]; len(data) > 0 || atEOF {
+			n, token, err := split(data, atEOF)
+			if n < 0 {
+				return nil, bufio.ErrNegativeAdvance
+			}
+			if n > len(data) {
+				return nil, bufio.ErrAdvanceTooFar
+			}
+			this.advance(n)
+			if err != nil || token != nil {
+				return token, err
+			}
+			if n > 0 {
+				continue
+			}
+			if atEOF {
+				return nil, io.EOF
+			}
+		}
+
+		if err := this.fillMore(); err == io.EOF {
+			atEOF = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SetMaxBuffer limits how many bytes the internal buffer may hold.
+// Peek requests larger than the limit fill the buffer up to the limit and return ErrBufferFull
+// along with the buffered bytes, which bounds memory use when peeking into untrusted input.
+//
+// Parameters:
+//   - size int: The maximum number of buffered bytes, or 0 to allow the buffer to grow without limit.
+//     Bytes that are already buffered beyond a smaller limit are kept until they are read.
+func (this *PeekBuffer) SetMaxBuffer(size int) {
+	if size < 0 {
+		size = 0
+	}
+	this.maxSize = size
+}
+
+// peekLimit returns how many bytes a Peek of size bytes may buffer, taking the maximum buffer size into account.
+func (this *PeekBuffer) peekLimit(size int) int {
+	if this.maxSize > 0 && size > this.maxSize {
+		return this.maxSize
+	}
+	return size
+}
+
+// peeked returns the result of a Peek of size bytes after the buffer has been filled.
+// io.EOF is dropped because a short slice already reports it, while any other error is returned alongside
+// the data, including io.ErrUnexpectedEOF from a reader that detected a truncated stream. ErrBufferFull
+// is returned if the buffer reached the maximum buffer size before size bytes could be buffered,
+// including when Prepend or SetMaxBuffer left more than the maximum buffer size buffered.
+func (this *PeekBuffer) peeked(size int, err error) ([]byte, error) {
+	have := this.Buffered()
+	if size < have {
+		have = size
+	}
+	this.stats.BytesPeeked += int64(have)
+
+	if err != nil && err != io.EOF {
+		return this.buffer[this.head : this.head+have], err
+	}
+	if this.maxSize > 0 && have < size && have >= this.maxSize {
+		return this.buffer[this.head : this.head+have], ErrBufferFull
+	}
+	return this.buffer[this.head : this.head+have], nil
+}
+
+// scan fills the buffer until match finds the end of a token in the buffered data.
+// match is called with data that has not been searched yet and returns the length of the data
+// up to the end of the match, or -1 if there is no match. Each fill reads whatever is available,
+// reserving space for up to fillSize more bytes, so scanning never blocks on data it doesn't need.
+//
+// Returns:
+//   - int: The number of buffered bytes up to the end of the match, or the number of buffered bytes if there is no match.
+//   - error: nil if a match was found, io.EOF if the stream ended first, ErrBufferFull if the maximum buffer size
+//     was reached first, or any other error encountered while reading.
+func (this *PeekBuffer) scan(match func(data []byte) int) (int, error) {
+	return this.search(match, false)
+}
+
+// search implements scan. If consume is true the searched data is consumed instead of kept buffered,
+// including the data up to the end of the match, so skipping a long run does not grow the buffer.
+// The returned count then includes every byte consumed.
+func (this *PeekBuffer) search(match func(data []byte) int, consume bool) (int, error) {
+	searched, consumed := 0, 0
+	var err error
+	for {
+		if i := match(this.buffer[this.head+searched : this.tail]); i >= 0 {
+			if consume {
+				this.advance(i)
+			}
+			return consumed + searched + i, nil
+		}
+		if consume {
+			consumed += this.Buffered()
+			this.advance(this.Buffered())
+		} else {
+			searched = this.Buffered()
+		}
+		if err != nil {
+			// Data that arrived together with the error has been searched
+			return consumed + searched, err
+		}
+		err = this.fillMore()
+	}
+}
+
+// fillMore buffers at least one more byte, reserving room for up to fillSize buffered bytes so that
+// incremental scans don't block on data they may not need. Once more than fillSize bytes are buffered
+// only one more byte is reserved, which lets reserve slide the data or grow the buffer geometrically.
+//
+// Returns:
+//   - error: nil if more data was buffered, ErrBufferFull if the buffer already holds the maximum
+//     buffer size, or the error that stopped the fill.
+func (this *PeekBuffer) fillMore() error {
+	size := this.fillSize - this.Buffered()
+	if size < 1 {
+		size = 1
+	}
+	if this.maxSize > 0 {
+		if this.Buffered() >= this.maxSize {
+			return ErrBufferFull
+		}
+		if size > this.maxSize-this.Buffered() {
+			size = this.maxSize - this.Buffered()
+		}
+	}
+	this.reserve(size)
+	return this.fill(1)
+}
+
+// fill reads from the underlying reader until at least need more bytes are buffered.
+// The read may use all of the free space after the tail so later calls can be served locally.
+// Unlike io.ReadAtLeast, errors are returned exactly as the underlying reader reported them.
+//
+// Returns:
+//   - error: nil once need bytes were buffered, otherwise the error that stopped the fill,
+//     which is io.EOF at the end of the stream even if some bytes were buffered.
+func (this *PeekBuffer) fill(need int) error {
+	return this.fillLimited(need, -1)
+}
+
+// fillLimited is like fill but reads at most limit bytes from the underlying reader, which must be at least need,
+// or any amount if limit is negative.
+func (this *PeekBuffer) fillLimited(need, limit int) error {
+	if this.err != nil {
+		return this.err
+	}
+	if this.pending != nil {
+		buffered := this.Buffered()
+		result := <-this.pending
+		this.pending = nil
+		this.appendRead(result)
+		// An error that arrived together with data ends the fill like any other
+		if result.err != nil || this.Buffered()-buffered >= need {
+			return result.err
+		}
+		need -= this.Buffered() - buffered
+	}
+	if this.eof && len(this.buffer)-this.tail < need {
+		// The stream ended last time, so check that it still has data before growing the buffer for it
+		n, err := this.read(this.probe[:])
+		if n > 0 {
+			this.eof = false
+			this.reserve(need)
+			this.buffer[this.tail] = this.probe[0]
+			this.tail++
+			need--
+			limit--
+		}
+		this.filled(n, err)
+		if err != nil {
+			this.setErr(err)
+			return err
+		}
+		if need == 0 {
+			return nil
+		}
+	}
+
+	this.reserve(need)
+	free := this.buffer[this.tail:]
+	if this.maxSize > 0 && len(free) > this.maxSize-this.Buffered() {
+		free = free[:this.maxSize-this.Buffered()]
+	}
+	if limit >= 0 && len(free) > limit {
+		free = free[:limit]
+	}
+	for filled, empty := 0, 0; filled < need; {
+		n, err := this.read(free[filled:])
+		filled += n
+		this.tail += n
+		this.filled(n, err)
+		if err != nil {
+			this.setErr(err)
+			return err
+		}
+		if n > 0 {
+			empty = 0
+			this.eof = false
+		} else if empty++; empty >= maxConsecutiveEmptyReads {
+			this.setErr(io.ErrNoProgress)
+			return io.ErrNoProgress
+		}
+	}
+	return nil
+}
+
+// setErr remembers the first error other than io.EOF returned by the underlying reader.
+// Timeouts are not remembered because the reader can be read again once its deadline is moved.
+// io.EOF is only noted so that fill can avoid growing the buffer for a stream that has ended.
+func (this *PeekBuffer) setErr(err error) {
+	if err == io.EOF {
+		this.eof = true
+	}
+	if err == nil || err == io.EOF || this.err != nil {
+		return
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return
+	}
+	this.err = err
+}
+
+// reserve ensures the backing array has room for at least n bytes after the tail.
+// Buffered data is slid to the front of the backing array when that frees enough space;
+// otherwise a larger array is allocated, rounded up to the next multiple of fillSize and at
+// least the previous size times the growth factor, so that with the default factor of 2 steadily
+// growing peeks are amortized like append.
+func (this *PeekBuffer) reserve(n int) {
+	if len(this.buffer)-this.tail >= n {
+		return
+	}
+	keep := this.keep()
+	used := this.tail - keep
+	if len(this.buffer)-used >= n {
+		copy(this.buffer, this.buffer[keep:this.tail])
+	} else {
+		// Round up to the next multiple of fillSize
+		size := ((used + n + this.fillSize - 1) / this.fillSize) * this.fillSize
+		factor := this.growthFactor
+		if factor == 0 {
+			factor = defaultGrowthFactor
+		}
+		if grown := int(float64(len(this.buffer)) * factor); size < grown {
+			size = grown
+		}
+		// Retained bytes that were already consumed don't count towards the maximum buffer size.
+		// Only the headroom is capped: the buffered data, which may already exceed the maximum after
+		// SetMaxBuffer or Prepend, and the n bytes asked for always fit
+		if limit := this.maxSize + this.head - keep; this.maxSize > 0 && size > limit {
+			size = limit
+		}
+		if size < used+n {
+			size = used + n
+		}
+		buffer := make([]byte, size)
+		copy(buffer, this.buffer[keep:this.tail])
+		this.buffer = buffer
+	}
+	this.rebase(keep)
+}
+
+// advance consumes n bytes from the front of the internal buffer.
+// Once the buffer is drained the indices rewind so the backing array is reused. A backing array
+// larger than both fillSize and the capacity asked for by Grow is instead released, and once more
+// than half of it has been consumed, or less than the WithShrinkPolicy threshold remains, the unread
+// tail is copied into a right-sized array so the rest can be garbage collected.
+// Consumed bytes that must be retained, such as those after a mark, are kept like unread data.
+func (this *PeekBuffer) advance(n int) {
+	this.consumed(this.buffer[this.head : this.head+n])
+	this.head += n
+	keep := this.keep()
+	if keep == this.tail {
+		this.rebase(keep)
+		if len(this.buffer) > this.retainSize() {
+			this.buffer = nil
+		}
+	} else if len(this.buffer) > this.retainSize() && (keep > len(this.buffer)/2 ||
+		(this.tail-keep < this.shrinkBelow && len(this.buffer) > 2*this.shrinkBelow)) {
+		this.buffer = append([]byte(nil), this.buffer[keep:this.tail]...)
+		this.rebase(keep)
+	}
+}
+
+// retainSize returns the size up to which a backing array is kept by advance rather than released or compacted.
+func (this *PeekBuffer) retainSize() int {
+	if this.capacity > this.fillSize {
+		return this.capacity
+	}
+	return this.fillSize
+}
+
+// consumed accounts for bytes that were just consumed from the stream and passes them to the tee and capture writers.
+// A tee write error is remembered like a read error and stops further teeing.
+func (this *PeekBuffer) consumed(p []byte) {
+	this.unread = false
+	if this.capture != nil && len(p) > 0 {
+		this.captured(p)
+	}
+	this.offset += int64(len(p))
+	if this.tee != nil && len(p) > 0 {
+		if _, err := this.tee.Write(p); err != nil {
+			this.tee = nil
+			if this.err == nil {
+				this.err = err
+			}
+		}
+	}
+}
+
+// captured writes the part of p, which is being consumed at the current offset, that has not been captured yet.
+func (this *PeekBuffer) captured(p []byte) {
+	start := this.captureFrom - this.offset
+	if start < 0 {
+		start = 0
+	}
+	if start >= int64(len(p)) {
+		return
+	}
+	p = p[start:]
+	if len(p) > this.captureLeft {
+		p = p[:this.captureLeft]
+	}
+	_, err := this.capture.Write(p)
+	this.captureLeft -= len(p)
+	this.captureFrom = this.offset + start + int64(len(p))
+	if err != nil || this.captureLeft == 0 {
+		this.capture = nil
+	}
+}
+
+// replace pushes p onto the front of the buffered data and moves the offset back.
+// p takes the place of the last len(p) consumed bytes, so retained bytes before them are kept and positions
+// retained within them, such as a mark, move back to the start of p. Pushing back the bytes that were consumed
+// therefore restores the original stream, which Rewind, Restore, RewindAll and History all see.
+// Positions past the current head have not been consumed yet and keep their place in the stream.
+func (this *PeekBuffer) replace(p []byte) {
+	this.unread = false
+	this.offset -= int64(len(p))
+
+	head := this.head
+	from := head - len(p)
+	to, shift := from, 0
+	if from < 0 {
+		// Every retained byte is replaced, so only the buffered data is moved along to make room for p
+		buffered := this.Buffered()
+		// Round up to the next multiple of fillSize
+		size := ((len(p) + buffered + this.fillSize - 1) / this.fillSize) * this.fillSize
+		buffer := make([]byte, size)
+		copy(buffer[len(p):], this.buffer[head:this.tail])
+		this.buffer = buffer
+		to, shift = 0, len(p)-head
+		this.tail += shift
+	}
+	// Positions within the replaced bytes move back to the start of p, those past the head move along with the data
+	if this.mark > head {
+		this.mark += shift
+	} else if this.mark >= from {
+		this.mark = to
+	}
+	if this.origin > head {
+		this.origin += shift
+	} else if this.origin >= from {
+		this.origin = to
+	}
+	for i := range this.snapshots {
+		pin := &this.snapshots[i]
+		if pin.index > head {
+			pin.index += shift
+		} else if pin.index >= from {
+			pin.index = to
+			pin.offset = this.offset
+		}
+	}
+	copy(this.buffer[to:], p)
+	this.head = to
+	this.grew()
+}
+
+// insert pushes p onto the front of the buffered data, after any retained bytes, and moves the offset back.
+func (this *PeekBuffer) insert(p []byte) {
+	this.unread = false
+	this.offset -= int64(len(p))
+
+	// Snapshots taken before the insertion point replay p as well, so their offsets move back like Offset
+	for i := range this.snapshots {
+		if this.snapshots[i].index < this.head {
+			this.snapshots[i].offset -= int64(len(p))
+		}
+	}
+	buffered := this.Buffered()
+	keep := this.keep()
+	if keep == this.head && len(p) <= this.head {
+		this.head -= len(p)
+		copy(this.buffer[this.head:], p)
+	} else {
+		// Insert p between the retained bytes and the buffered data
+		retained := this.head - keep
+		// Round up to the next multiple of fillSize
+		size := ((retained + len(p) + buffered + this.fillSize - 1) / this.fillSize) * this.fillSize
+		buffer := make([]byte, size)
+		copy(buffer, this.buffer[keep:this.head])
+		copy(buffer[retained:], p)
+		copy(buffer[retained+len(p):], this.buffer[this.head:this.tail])
+		// Positions at or after the insertion point now follow p, as they do when inserting in place
+		if this.mark >= this.head {
+			this.mark += len(p)
+		}
+		if this.origin >= this.head {
+			this.origin += len(p)
+		}
+		for i := range this.snapshots {
+			if this.snapshots[i].index >= this.head {
+				this.snapshots[i].index += len(p)
+			}
+		}
+		this.buffer = buffer
+		this.rebase(keep)
+		this.tail += len(p)
+	}
+	this.grew()
+}
+
+// keep returns the index of the first byte in buffer that must be retained.
+// This is the head, unless consumed bytes are being retained for History, Rewind or Restore.
+// Everything before the head in buffer has been consumed, and the history before the earliest
+// position the head can return to is retained so that History is complete after returning.
+func (this *PeekBuffer) keep() int {
+	keep := this.head
+	if this.marked && this.mark < keep {
+		keep = this.mark
+	}
+	if this.recording && this.origin < keep {
+		keep = this.origin
+	}
+	for _, pin := range this.snapshots {
+		if pin.index < keep {
+			keep = pin.index
+		}
+	}
+	if this.historySize > 0 {
+		if keep -= this.historySize; keep < 0 {
+			keep = 0
+		}
+	}
+	return keep
+}
+
+// retaining reports whether consumed bytes must be retained in the buffer rather than dropped.
+func (this *PeekBuffer) retaining() bool {
+	return this.marked || this.recording || this.historySize > 0 || len(this.snapshots) > 0
+}
+
+// rebase moves the indices into buffer down by n after the data from n onwards was moved to the front.
+func (this *PeekBuffer) rebase(n int) {
+	this.head -= n
+	this.tail -= n
+	this.mark -= n
+	this.origin -= n
+	for i := range this.snapshots {
+		this.snapshots[i].index -= n
+	}
+}
+
+// errorRecorder is a reader that remembers the last error returned by the reader it wraps,
+// so read errors can be told apart from write errors after an io.Copy.
+type errorRecorder struct {
+	reader io.Reader
+	err    error
+}
+
+func (this *errorRecorder) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	if err != nil {
+		this.err = err
+	}
+	return n, err
+}
+
+// errReader is a reader that always fails with err.
+type errReader struct {
+	err error
+}
+
+func (this *errReader) Read(p []byte) (int, error) {
+	return 0, this.err
+}
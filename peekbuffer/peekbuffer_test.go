@@ -1,9 +1,19 @@
 package peekbuffer
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"unicode/utf8"
 )
 
 func TestNewPeekBuffer(t *testing.T) {
@@ -88,6 +98,43 @@ func TestPeekBuffer_Peek(t *testing.T) {
 	}
 }
 
+func TestPeekBuffer_PeekNegativeSize(t *testing.T) {
+	tests := []struct {
+		name string
+		peek func(pb *PeekBuffer) error
+	}{
+		{"Peek", func(pb *PeekBuffer) error { _, err := pb.Peek(-1); return err }},
+		{"PeekFull", func(pb *PeekBuffer) error { _, err := pb.PeekFull(-1); return err }},
+		{"PeekLimited", func(pb *PeekBuffer) error { _, err := pb.PeekLimited(-1, 4); return err }},
+		{"PeekString", func(pb *PeekBuffer) error { _, err := pb.PeekString(-1); return err }},
+		{"PeekExact", func(pb *PeekBuffer) error { _, err := pb.PeekExact(-1, nil); return err }},
+		{"PeekContext", func(pb *PeekBuffer) error { _, err := pb.PeekContext(context.Background(), -1); return err }},
+		{"PeekAt", func(pb *PeekBuffer) error { _, err := pb.PeekAt(1, -1); return err }},
+		{"Available", func(pb *PeekBuffer) error { _, err := pb.Available(-1); return err }},
+		{"Fill", func(pb *PeekBuffer) error { return pb.Fill(-1) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte("hello")))
+			pb.Peek(2)
+
+			if err := tt.peek(pb); err != ErrNegativeSize {
+				t.Errorf("%s(-1) error = %v, want %v", tt.name, err, ErrNegativeSize)
+			}
+			if err := tt.peek(pb); !errors.Is(err, bufio.ErrNegativeCount) {
+				t.Errorf("%s(-1) error = %v, want bufio.ErrNegativeCount", tt.name, err)
+			}
+
+			// The stream is left untouched
+			got, err := io.ReadAll(pb)
+			if err != nil || string(got) != "hello" {
+				t.Errorf("ReadAll() = %q, %v, want %q, nil", got, err, "hello")
+			}
+		})
+	}
+}
+
 func TestPeekBuffer_PeekThenRead(t *testing.T) {
 	input := "hello world"
 	pb := NewPeekBuffer(bytes.NewReader([]byte(input)))
@@ -121,6 +168,51 @@ func TestPeekBuffer_PeekThenRead(t *testing.T) {
 	}
 }
 
+func TestPeekBuffer_PeekMultiReader(t *testing.T) {
+	// Each segment reports io.EOF with its last byte, and MultiReader hides those from the PeekBuffer,
+	// so the short reads at segment boundaries must not be mistaken for the end of the stream.
+	segments := func() io.Reader {
+		return io.MultiReader(
+			iotest.DataErrReader(strings.NewReader("he")),
+			strings.NewReader(""),
+			iotest.DataErrReader(strings.NewReader("l")),
+			iotest.OneByteReader(strings.NewReader("lo ")),
+			iotest.DataErrReader(strings.NewReader("world")),
+		)
+	}
+
+	tests := []struct {
+		name          string
+		size          int
+		want          string
+		wantStrictErr error
+	}{
+		{"Within first segment", 2, "he", nil},
+		{"Across one boundary", 3, "hel", nil},
+		{"Across all boundaries", 11, "hello world", nil},
+		{"Past end", 20, "hello world", io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(segments(), 4)
+			got, err := pb.Peek(tt.size)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Peek() got = %q, err %v, want %q", got, err, tt.want)
+			}
+
+			pb = New(segments(), WithFillSize(4), WithStrictEOF())
+			got, err = pb.Peek(tt.size)
+			if err != tt.wantStrictErr || string(got) != tt.want {
+				t.Errorf("Peek() with WithStrictEOF got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantStrictErr)
+			}
+			if all, err := io.ReadAll(pb); err != nil || string(all) != "hello world" {
+				t.Errorf("ReadAll() after Peek got = %q, err %v", all, err)
+			}
+		})
+	}
+}
+
 func TestPeekBuffer_LargeInput(t *testing.T) {
 	largeInput := make([]byte, 1<<20) // 1 MB of data
 	for i := range largeInput {
@@ -215,6 +307,85 @@ func (e *ErrorReader) Read(p []byte) (n int, err error) {
 	return 0, e.err
 }
 
+// DataErrorReader is a mock reader that returns its data together with an error in a single Read
+type DataErrorReader struct {
+	data []byte
+	err  error
+}
+
+func (d *DataErrorReader) Read(p []byte) (n int, err error) {
+	n = copy(p, d.data)
+	d.data = d.data[n:]
+	return n, d.err
+}
+
+func TestPeekBuffer_DataWithError(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		err     error
+		peek    func(pb *PeekBuffer) ([]byte, error)
+		want    string
+		wantErr error
+		rest    string
+	}{
+		{"Peek", readErr, func(pb *PeekBuffer) ([]byte, error) { return pb.Peek(10) }, "abc", readErr, "abc"},
+		{"Peek unexpected EOF", io.ErrUnexpectedEOF, func(pb *PeekBuffer) ([]byte, error) { return pb.Peek(10) }, "abc", io.ErrUnexpectedEOF, "abc"},
+		{"Peek EOF", io.EOF, func(pb *PeekBuffer) ([]byte, error) { return pb.Peek(10) }, "abc", nil, "abc"},
+		{"PeekFull", readErr, func(pb *PeekBuffer) ([]byte, error) { return pb.PeekFull(10) }, "abc", readErr, "abc"},
+		{"PeekAt", readErr, func(pb *PeekBuffer) ([]byte, error) { return pb.PeekAt(1, 10) }, "bc", readErr, "abc"},
+		{"PeekAll", readErr, func(pb *PeekBuffer) ([]byte, error) { return pb.PeekAll() }, "abc", readErr, "abc"},
+		{"PeekUntil", readErr, func(pb *PeekBuffer) ([]byte, error) { return pb.PeekUntil('b') }, "ab", nil, "abc"},
+		{"PeekUntil EOF", io.EOF, func(pb *PeekBuffer) ([]byte, error) { return pb.PeekUntil('c') }, "abc", nil, "abc"},
+		{"Read", readErr, func(pb *PeekBuffer) ([]byte, error) {
+			p := make([]byte, 10)
+			n, err := pb.Read(p)
+			return p[:n], err
+		}, "abc", readErr, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(&DataErrorReader{data: []byte("abc"), err: tt.err})
+			got, err := tt.peek(pb)
+			if err != tt.wantErr || string(got) != tt.want {
+				t.Errorf("got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+
+			// Peeked data is still returned before the error
+			rest, err := io.ReadAll(pb)
+			if string(rest) != tt.rest || (err != tt.err && tt.err != io.EOF) {
+				t.Errorf("ReadAll() got = %q, err %v, want %q, err %v", rest, err, tt.rest, tt.err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekErrorKeepsBufferedData(t *testing.T) {
+	readErr := errors.New("read failed")
+	// The first fill reads more than the peek asked for before the error
+	pb := NewPeekBuffer(&DataErrorReader{data: []byte("hello world"), err: readErr})
+
+	peeked, err := pb.Peek(2)
+	if err != readErr || string(peeked) != "he" {
+		t.Errorf("Peek(2) got = %q, err %v, want %q, %v", peeked, err, "he", readErr)
+	}
+	if pb.Buffered() != 11 {
+		t.Errorf("Buffered() after Peek error got = %v, want 11", pb.Buffered())
+	}
+
+	// The rest of the data stays buffered for later calls
+	peeked, err = pb.Peek(11)
+	if err != nil || string(peeked) != "hello world" {
+		t.Errorf("Peek(11) got = %q, err %v, want %q", peeked, err, "hello world")
+	}
+	got, err := io.ReadAll(pb)
+	if err != readErr || string(got) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v, want %q, %v", got, err, "hello world", readErr)
+	}
+}
+
 func TestPeekBuffer_ModifyPeekedData(t *testing.T) {
 	input := "modify peeked data"
 	pb := NewPeekBuffer(bytes.NewReader([]byte(input)))
@@ -269,6 +440,299 @@ func TestPeekBuffer_ReadByte(t *testing.T) {
 	}
 }
 
+func TestPeekBuffer_ReadFill(t *testing.T) {
+	input := benchmarkInput()[:10000]
+
+	tests := []struct {
+		name   string
+		peek   int
+		size   int
+		want   int
+		reader func() io.Reader
+	}{
+		{"Buffer then reader", 100, 5000, 5000, func() io.Reader { return bytes.NewReader(input) }},
+		{"Reader only", 0, 5000, 5000, func() io.Reader { return bytes.NewReader(input) }},
+		{"Buffer only", 5000, 100, 100, func() io.Reader { return bytes.NewReader(input) }},
+		{"Short reads", 10, 5000, 5000, func() io.Reader { return iotest.OneByteReader(bytes.NewReader(input)) }},
+		{"Stream ends", 100, 20000, 10000, func() io.Reader { return bytes.NewReader(input) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader())
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+
+			p := make([]byte, tt.size)
+			n, err := pb.ReadFill(p)
+			if n != tt.want || err != nil || !bytes.Equal(p[:n], input[:n]) {
+				t.Errorf("ReadFill() got = %v, err %v, want %v", n, err, tt.want)
+			}
+			remaining, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(remaining, input[n:]) {
+				t.Errorf("ReadAll() got %d bytes, err %v, want %d", len(remaining), err, len(input)-n)
+			}
+			if n, err := pb.ReadFill(p); n != 0 || err != io.EOF {
+				t.Errorf("ReadFill() at EOF got = %v, err %v, want 0, io.EOF", n, err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_ReadFillError(t *testing.T) {
+	readErr := errors.New("read failed")
+	pb := NewPeekBuffer(io.MultiReader(bytes.NewReader([]byte("hello")), &ErrorReader{err: readErr}))
+	n, err := pb.ReadFill(make([]byte, 10))
+	if n != 5 || err != readErr {
+		t.Errorf("ReadFill() got = %v, err %v, want 5, %v", n, err, readErr)
+	}
+
+	pb = NewPeekBuffer(&ErrorReader{})
+	if n, err := pb.ReadFill(make([]byte, 10)); n != 0 || err != io.ErrNoProgress {
+		t.Errorf("ReadFill() got = %v, err %v, want 0, %v", n, err, io.ErrNoProgress)
+	}
+}
+
+func TestPeekBuffer_ReadAtLeast(t *testing.T) {
+	input := benchmarkInput()[:10000]
+
+	tests := []struct {
+		name    string
+		peek    int
+		size    int
+		min     int
+		want    int
+		wantErr error
+		reader  func() io.Reader
+	}{
+		{"Buffer only", 100, 5000, 50, FillPeekBufferSize, nil, func() io.Reader { return bytes.NewReader(input) }},
+		{"Buffer then reader", 100, 5000, 5000, 5000, nil, func() io.Reader { return bytes.NewReader(input) }},
+		{"Reader only", 0, 5000, 5000, 5000, nil, func() io.Reader { return bytes.NewReader(input) }},
+		{"Short reads", 10, 100, 50, 50, nil, func() io.Reader { return iotest.OneByteReader(bytes.NewReader(input)) }},
+		{"Stream ends", 100, 20000, 15000, 10000, io.ErrUnexpectedEOF, func() io.Reader { return bytes.NewReader(input) }},
+		{"Short buffer", 100, 10, 20, 0, io.ErrShortBuffer, func() io.Reader { return bytes.NewReader(input) }},
+		{"Zero min", 0, 10, 0, 0, nil, func() io.Reader { return bytes.NewReader(input) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader())
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+
+			p := make([]byte, tt.size)
+			n, err := pb.ReadAtLeast(p, tt.min)
+			if n != tt.want || err != tt.wantErr || !bytes.Equal(p[:n], input[:n]) {
+				t.Errorf("ReadAtLeast() got = %v, err %v, want %v, %v", n, err, tt.want, tt.wantErr)
+			}
+			remaining, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(remaining, input[n:]) {
+				t.Errorf("ReadAll() got %d bytes, err %v, want %d", len(remaining), err, len(input)-n)
+			}
+			if n, err := pb.ReadAtLeast(p, 1); n != 0 || err != io.EOF {
+				t.Errorf("ReadAtLeast() at EOF got = %v, err %v, want 0, io.EOF", n, err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_ReadAtLeastError(t *testing.T) {
+	readErr := errors.New("read failed")
+	pb := NewPeekBuffer(io.MultiReader(bytes.NewReader([]byte("hello")), &ErrorReader{err: readErr}))
+	n, err := pb.ReadAtLeast(make([]byte, 10), 8)
+	if n != 5 || err != readErr {
+		t.Errorf("ReadAtLeast() got = %v, err %v, want 5, %v", n, err, readErr)
+	}
+
+	pb = NewPeekBuffer(&ErrorReader{})
+	if n, err := pb.ReadAtLeast(make([]byte, 10), 1); n != 0 || err != io.ErrNoProgress {
+		t.Errorf("ReadAtLeast() got = %v, err %v, want 0, %v", n, err, io.ErrNoProgress)
+	}
+}
+
+func TestPeekBuffer_ReadN(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name     string
+		reader   io.Reader
+		fillSize int
+		peek     int
+		n        int
+		want     string
+		wantErr  error
+		wantRest string
+	}{
+		{"Exact", strings.NewReader("hello world"), 4096, 0, 5, "hello", nil, " world"},
+		{"Whole stream", strings.NewReader("hello world"), 4096, 0, 11, "hello world", nil, ""},
+		{"From buffer", strings.NewReader("hello world"), 4096, 8, 5, "hello", nil, " world"},
+		{"Multiple fills", strings.NewReader("hello world"), 4, 2, 10, "hello worl", nil, "d"},
+		{"Short reads", iotest.OneByteReader(strings.NewReader("hello world")), 4096, 0, 7, "hello w", nil, "orld"},
+		{"Short stream", strings.NewReader("hello"), 4, 2, 8, "hello", io.ErrUnexpectedEOF, ""},
+		{"Empty stream", strings.NewReader(""), 4096, 0, 3, "", io.EOF, ""},
+		{"Zero", strings.NewReader("hello"), 4096, 0, 0, "", nil, "hello"},
+		{"Negative", strings.NewReader("hello"), 4096, 0, -1, "", ErrNegativeSize, "hello"},
+		{"Read error", io.MultiReader(strings.NewReader("hel"), &ErrorReader{err: readErr}), 4096, 0, 5, "hel", readErr, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(tt.reader, tt.fillSize)
+			pb.Peek(tt.peek)
+
+			got, err := pb.ReadN(tt.n)
+			if string(got) != tt.want || err != tt.wantErr {
+				t.Errorf("ReadN(%d) got = %q, err %v, want %q, %v", tt.n, got, err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != int64(len(got)) {
+				t.Errorf("Offset() = %d, want %d", pb.Offset(), len(got))
+			}
+			if tt.wantErr == readErr {
+				return
+			}
+			rest, err := io.ReadAll(pb)
+			if err != nil || string(rest) != tt.wantRest {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", rest, err, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_ReadNCopies(t *testing.T) {
+	pb := NewPeekBuffer(strings.NewReader("hello world"))
+	got, err := pb.ReadN(5)
+	if err != nil {
+		t.Fatalf("ReadN() error = %v", err)
+	}
+	// The result does not alias the internal buffer, so later reads leave it alone
+	pb.Unread([]byte("HELLO"))
+	pb.ReadN(11)
+	if string(got) != "hello" {
+		t.Errorf("ReadN() result changed to %q", got)
+	}
+}
+
+func TestPeekBuffer_ConsumePeeked(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if err := pb.ConsumePeeked(1); err != ErrNotBuffered {
+		t.Errorf("ConsumePeeked() with nothing buffered error = %v, want %v", err, ErrNotBuffered)
+	}
+	if err := pb.ConsumePeeked(0); err != nil {
+		t.Errorf("ConsumePeeked(0) error = %v", err)
+	}
+
+	pb.Peek(5)
+	pb.reader = PanicReader{}
+	if err := pb.ConsumePeeked(-1); err != bufio.ErrNegativeCount {
+		t.Errorf("ConsumePeeked(-1) error = %v, want %v", err, bufio.ErrNegativeCount)
+	}
+	if err := pb.ConsumePeeked(12); err != ErrNotBuffered {
+		t.Errorf("ConsumePeeked(12) error = %v, want %v", err, ErrNotBuffered)
+	}
+	if err := pb.ConsumePeeked(6); err != nil {
+		t.Errorf("ConsumePeeked(6) error = %v", err)
+	}
+	if got := pb.Peeked(); string(got) != "world" || pb.Offset() != 6 {
+		t.Errorf("ConsumePeeked() left %q at offset %d, want %q at 6", got, pb.Offset(), "world")
+	}
+	if err := pb.ConsumePeeked(5); err != nil || pb.Buffered() != 0 {
+		t.Errorf("ConsumePeeked(5) error = %v, left %d bytes", err, pb.Buffered())
+	}
+}
+
+func TestPeekBuffer_DrainBuffered(t *testing.T) {
+	pb := NewPeekBufferSize(&ErrorReader{err: errors.New("DrainBuffered read from the reader")}, 4)
+	if n := pb.DrainBuffered(make([]byte, 10)); n != 0 {
+		t.Errorf("DrainBuffered() on an empty buffer got = %v, want 0", n)
+	}
+
+	pb.Reset(bytes.NewReader([]byte("hello world")))
+	pb.Peek(5)
+	pb.reader = &ErrorReader{err: errors.New("DrainBuffered read from the reader")}
+
+	p := make([]byte, 3)
+	if n := pb.DrainBuffered(p); n != 3 || string(p) != "hel" {
+		t.Errorf("DrainBuffered() got = %v %q, want 3 %q", n, p, "hel")
+	}
+	p = make([]byte, 10)
+	if n := pb.DrainBuffered(p); n != 5 || string(p[:n]) != "lo wo" {
+		t.Errorf("DrainBuffered() got = %v %q, want 5 %q", n, p[:n], "lo wo")
+	}
+	if n := pb.DrainBuffered(p); n != 0 {
+		t.Errorf("DrainBuffered() after draining got = %v, want 0", n)
+	}
+	if pb.Offset() != 8 {
+		t.Errorf("Offset() got = %v, want 8", pb.Offset())
+	}
+}
+
+func TestPeekBuffer_ReadByteAllocs(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader(benchmarkInput()))
+	if _, err := pb.ReadByte(); err != nil {
+		t.Fatalf("ReadByte() error = %v", err)
+	}
+
+	// Enough reads to cross several fill boundaries.
+	allocs := testing.AllocsPerRun(5*FillPeekBufferSize, func() {
+		pb.ReadByte()
+	})
+	if allocs != 0 {
+		t.Errorf("ReadByte() allocated %v times per call, want 0", allocs)
+	}
+}
+
+func TestPeekBuffer_PeekAtEOFAllocs(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if peeked, err := pb.Peek(20); err != nil || string(peeked) != "hello world" {
+		t.Fatalf("Peek() got = %q, err %v", peeked, err)
+	}
+	size := len(pb.buffer)
+
+	// The stream has ended, so peeking further must not grow the buffer
+	allocs := testing.AllocsPerRun(10, func() {
+		pb.Peek(1 << 20)
+	})
+	if allocs != 0 {
+		t.Errorf("Peek() at EOF allocated %v times per call, want 0", allocs)
+	}
+	if len(pb.buffer) != size {
+		t.Errorf("Peek() at EOF grew the buffer from %d to %d bytes", size, len(pb.buffer))
+	}
+}
+
+// ResumingReader is a mock reader that returns io.EOF between chunks, like a file that is still being written
+type ResumingReader struct {
+	chunks [][]byte
+}
+
+func (r *ResumingReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestPeekBuffer_PeekAfterEOF(t *testing.T) {
+	input := benchmarkInput()[:20000]
+	pb := NewPeekBuffer(&ResumingReader{chunks: [][]byte{input[:10], input[10:]}})
+	if peeked, err := pb.Peek(100); err != nil || len(peeked) != 10 {
+		t.Fatalf("Peek() got %d bytes, err %v, want 10", len(peeked), err)
+	}
+
+	// The stream continues after io.EOF, so the probe byte must be kept
+	peeked, err := pb.Peek(len(input))
+	if err != nil || !bytes.Equal(peeked, input) {
+		t.Errorf("Peek() after EOF got %d bytes, err %v, want %d", len(peeked), err, len(input))
+	}
+}
+
 func TestPeekBuffer_PeekByte(t *testing.T) {
 	const input = "hello world"
 
@@ -286,6 +750,7 @@ func TestPeekBuffer_PeekByte(t *testing.T) {
 		{"Peek fifth byte", []peekTest{{4, 'o'}}, false},
 		{"Peek last byte", []peekTest{{10, 'd'}}, false},
 		{"Peek out of bounds", []peekTest{{11, 0}}, true},
+		{"Peek negative offset", []peekTest{{-1, 0}}, true},
 	}
 
 	for _, tt := range tests {
@@ -306,3 +771,2817 @@ func TestPeekBuffer_PeekByte(t *testing.T) {
 		})
 	}
 }
+
+func TestPeekBuffer_Discard(t *testing.T) {
+	const input = "hello world"
+
+	tests := []struct {
+		name      string
+		peek      int
+		discard   int
+		want      int
+		wantErr   error
+		remaining string
+	}{
+		{"Discard none", 0, 0, 0, nil, "hello world"},
+		{"Discard from reader", 0, 6, 6, nil, "world"},
+		{"Discard from buffer", 8, 6, 6, nil, "world"},
+		{"Discard across buffer", 3, 6, 6, nil, "world"},
+		{"Discard all", 11, 11, 11, nil, ""},
+		{"Discard more than available", 3, 15, 11, io.ErrUnexpectedEOF, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(input)))
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+
+			got, err := pb.Discard(tt.discard)
+			if err != tt.wantErr {
+				t.Errorf("Discard(%d) error = %v, wantErr %v", tt.discard, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Discard(%d) got = %v, want %v", tt.discard, got, tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(remaining) != tt.remaining {
+				t.Errorf("ReadAll() got = %v, want %v", string(remaining), tt.remaining)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_DiscardEmpty(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader(nil))
+	got, err := pb.Discard(5)
+	if err != io.EOF {
+		t.Errorf("Discard() error = %v, want %v", err, io.EOF)
+	}
+	if got != 0 {
+		t.Errorf("Discard() got = %v, want 0", got)
+	}
+}
+
+func TestPeekBuffer_SkipFunc(t *testing.T) {
+	isSpace := func(b byte) bool { return b == ' ' || b == '\t' }
+
+	tests := []struct {
+		name     string
+		input    string
+		fillSize int
+		want     int
+		wantErr  error
+		rest     string
+	}{
+		{"Leading spaces", "  \thello", 4096, 3, nil, "hello"},
+		{"Run across fills", "        hello", 3, 8, nil, "hello"},
+		{"Nothing to skip", "hello", 3, 0, nil, "hello"},
+		{"All skipped", "   ", 2, 3, io.EOF, ""},
+		{"Empty", "", 3, 0, io.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), tt.fillSize)
+			got, err := pb.SkipFunc(isSpace)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("SkipFunc() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != int64(tt.want) {
+				t.Errorf("Offset() got = %v, want %v", pb.Offset(), tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.rest {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.rest)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_DiscardUntil(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		fillSize int
+		want     int
+		wantErr  error
+		rest     string
+	}{
+		{"Delimiter in first fill", "garbage\nnext", 4096, 8, nil, "next"},
+		{"Delimiter across fills", "more garbage\nnext", 3, 13, nil, "next"},
+		{"Delimiter first", "\nnext", 3, 1, nil, "next"},
+		{"Delimiter last", "garbage\n", 3, 8, nil, ""},
+		{"No delimiter", "garbage", 3, 7, io.EOF, ""},
+		{"Empty", "", 3, 0, io.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), tt.fillSize)
+			got, err := pb.DiscardUntil('\n')
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("DiscardUntil() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.rest {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.rest)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_DiscardUntilDataWithError(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr error
+		rest    string
+	}{
+		{"Delimiter in last read", "abc\ndef", 4, nil, "def"},
+		{"No delimiter", "abcdef", 6, io.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(iotest.DataErrReader(strings.NewReader(tt.input)))
+			got, err := pb.DiscardUntil('\n')
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("DiscardUntil() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.rest {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.rest)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_DiscardUntilLongRun(t *testing.T) {
+	input := append(bytes.Repeat([]byte{'x'}, 1<<20), "\nhello"...)
+	pb := NewPeekBuffer(bytes.NewReader(input))
+	if got, err := pb.DiscardUntil('\n'); got != 1<<20+1 || err != nil {
+		t.Fatalf("DiscardUntil() got = %v, err %v", got, err)
+	}
+	if len(pb.buffer) > FillPeekBufferSize {
+		t.Errorf("DiscardUntil() grew the buffer to %d bytes", len(pb.buffer))
+	}
+	if got, err := pb.Peek(5); string(got) != "hello" || err != nil {
+		t.Errorf("Peek() after DiscardUntil got = %q, err %v", got, err)
+	}
+}
+
+func TestPeekBuffer_SkipFuncDataWithError(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr error
+		rest    string
+	}{
+		{"Match in last read", "   x", 3, nil, "x"},
+		{"No match", "    ", 4, io.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(iotest.DataErrReader(strings.NewReader(tt.input)))
+			got, err := pb.SkipFunc(func(b byte) bool { return b == ' ' })
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("SkipFunc() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.rest {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.rest)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_SkipFuncLongRun(t *testing.T) {
+	input := append(bytes.Repeat([]byte{' '}, 1<<20), "hello"...)
+	pb := NewPeekBuffer(bytes.NewReader(input))
+	if got, err := pb.SkipFunc(func(b byte) bool { return b == ' ' }); got != 1<<20 || err != nil {
+		t.Fatalf("SkipFunc() got = %v, err %v", got, err)
+	}
+	if len(pb.buffer) > FillPeekBufferSize {
+		t.Errorf("SkipFunc() grew the buffer to %d bytes", len(pb.buffer))
+	}
+	if got, err := pb.Peek(5); string(got) != "hello" || err != nil {
+		t.Errorf("Peek() after SkipFunc got = %q, err %v", got, err)
+	}
+}
+
+func TestPeekBuffer_CopyN(t *testing.T) {
+	input := benchmarkInput()[:10000]
+
+	tests := []struct {
+		name    string
+		peek    int
+		n       int64
+		setup   func(pb *PeekBuffer, tee *bytes.Buffer)
+		want    int64
+		wantErr error
+	}{
+		{"Buffer only", 5000, 100, nil, 100, nil},
+		{"Buffer then reader", 100, 5000, nil, 5000, nil},
+		{"Reader only", 0, 5000, nil, 5000, nil},
+		{"Stream ends", 100, 20000, nil, 10000, io.EOF},
+		{"Zero", 100, 0, nil, 0, nil},
+		{"Tee", 100, 5000, func(pb *PeekBuffer, tee *bytes.Buffer) { pb.SetTee(tee) }, 5000, nil},
+		{"Mark", 100, 5000, func(pb *PeekBuffer, tee *bytes.Buffer) { pb.Mark() }, 5000, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+			pb.Peek(tt.peek)
+			var tee bytes.Buffer
+			if tt.setup != nil {
+				tt.setup(pb, &tee)
+			}
+
+			var out bytes.Buffer
+			written, err := pb.CopyN(&out, tt.n)
+			if written != tt.want || err != tt.wantErr || !bytes.Equal(out.Bytes(), input[:written]) {
+				t.Errorf("CopyN() got = %v, err %v, want %v, err %v", written, err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != written {
+				t.Errorf("Offset() after CopyN got = %v, want %v", pb.Offset(), written)
+			}
+			if tee.Len() > 0 && !bytes.Equal(tee.Bytes(), out.Bytes()) {
+				t.Errorf("tee got %d bytes, want the %d copied bytes", tee.Len(), out.Len())
+			}
+			if pb.Rewind() == nil {
+				written = 0
+			}
+			if rest, err := io.ReadAll(pb); err != nil || !bytes.Equal(rest, input[written:]) {
+				t.Errorf("ReadAll() after CopyN got %d bytes, err %v, want %d", len(rest), err, len(input)-int(written))
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_CopyNErrors(t *testing.T) {
+	readErr := errors.New("read failed")
+	pb := NewPeekBuffer(io.MultiReader(strings.NewReader("hello"), &ErrorReader{err: readErr}))
+	pb.Peek(2)
+	var out bytes.Buffer
+	if written, err := pb.CopyN(&out, 10); written != 5 || err != readErr || out.String() != "hello" {
+		t.Errorf("CopyN() got = %v, err %v, want 5, %v", written, err, readErr)
+	}
+	if _, err := pb.Peek(1); err != readErr {
+		t.Errorf("Peek() after CopyN error = %v, want the read error to be remembered", err)
+	}
+
+	w := &FailingWriter{}
+	pb = NewPeekBuffer(strings.NewReader("hello"))
+	pb.Peek(2)
+	if written, err := pb.CopyN(w, 5); written != 0 || err == nil {
+		t.Errorf("CopyN() to a failing writer got = %v, err %v, want an error", written, err)
+	}
+	if got, _ := io.ReadAll(pb); string(got) != "hello" {
+		t.Errorf("ReadAll() after failed CopyN got = %q, want %q", got, "hello")
+	}
+}
+
+func TestPeekBuffer_Reset(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("first stream")))
+	if _, err := pb.Peek(5); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+
+	reader := bytes.NewReader([]byte("second"))
+	pb.Reset(reader)
+	if pb.reader != reader {
+		t.Error("Reset did not set the reader correctly")
+	}
+
+	got, err := io.ReadAll(pb)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != "second" {
+		t.Errorf("ReadAll() got = %v, want %v", string(got), "second")
+	}
+}
+
+func TestNewPeekBufferSize(t *testing.T) {
+	const input = "hello world"
+
+	for _, fillSize := range []int{1, 2, 3, 7, 4096} {
+		pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), fillSize)
+		if pb.fillSize != fillSize {
+			t.Errorf("NewPeekBufferSize(%d) fillSize = %d", fillSize, pb.fillSize)
+		}
+
+		peeked, err := pb.Peek(5)
+		if err != nil || string(peeked) != "hello" {
+			t.Errorf("Peek() with fill size %d got = %v, err %v", fillSize, string(peeked), err)
+		}
+		b, err := pb.ReadByte()
+		if err != nil || b != 'h' {
+			t.Errorf("ReadByte() with fill size %d got = %v, err %v", fillSize, b, err)
+		}
+		remaining, err := io.ReadAll(pb)
+		if err != nil || string(remaining) != "ello world" {
+			t.Errorf("ReadAll() with fill size %d got = %v, err %v", fillSize, string(remaining), err)
+		}
+	}
+}
+
+func TestNewPeekBufferSize_Invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewPeekBufferSize(0) did not panic")
+		}
+	}()
+	NewPeekBufferSize(bytes.NewReader(nil), 0)
+}
+
+func TestNewPeekBufferBytes(t *testing.T) {
+	for _, size := range []int{0, 1, 11, 4095, 4096, 10000} {
+		input := benchmarkInput()[:size]
+		pb := NewPeekBufferBytes(input)
+
+		peeked, err := pb.Peek(size + 1)
+		if err != nil || !bytes.Equal(peeked, input) {
+			t.Errorf("Peek() with %d bytes got %d bytes, err %v", size, len(peeked), err)
+		}
+		if size < FillPeekBufferSize && len(pb.buffer) != size+1 {
+			t.Errorf("Peek() with %d bytes allocated a %d byte buffer, want %d", size, len(pb.buffer), size+1)
+		}
+		remaining, err := io.ReadAll(pb)
+		if err != nil || !bytes.Equal(remaining, input) {
+			t.Errorf("ReadAll() with %d bytes got %d bytes, err %v", size, len(remaining), err)
+		}
+	}
+}
+
+func TestPeekBuffer_ResetKeepBuffer(t *testing.T) {
+	readErr := errors.New("connection reset")
+	pb := NewPeekBuffer(io.MultiReader(strings.NewReader("hello "), &ErrorReader{err: readErr}))
+	if _, err := pb.Discard(1); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if _, err := pb.Peek(10); err != readErr {
+		t.Fatalf("Peek() error = %v, want %v", err, readErr)
+	}
+
+	pb.ResetKeepBuffer(strings.NewReader("world"))
+	if got := pb.Offset(); got != 1 {
+		t.Errorf("Offset() after ResetKeepBuffer got = %v, want 1", got)
+	}
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "ello world" {
+		t.Errorf("ReadAll() after ResetKeepBuffer got = %q, err %v, want %q", got, err, "ello world")
+	}
+}
+
+func TestPeekBuffer_Buffered(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if got := pb.Buffered(); got != 0 {
+		t.Errorf("Buffered() before Peek got = %v, want 0", got)
+	}
+
+	if _, err := pb.Peek(5); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	if got := pb.Buffered(); got != 11 {
+		t.Errorf("Buffered() after Peek got = %v, want 11", got)
+	}
+
+	if _, err := pb.Read(make([]byte, 4)); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got := pb.Buffered(); got != 7 {
+		t.Errorf("Buffered() after Read got = %v, want 7", got)
+	}
+}
+
+func TestPeekBuffer_ReleasesConsumedData(t *testing.T) {
+	const size = 10 << 20 // 10 MB
+	pb := NewPeekBuffer(bytes.NewReader(make([]byte, size)))
+
+	peeked, err := pb.Peek(size)
+	if err != nil || len(peeked) != size {
+		t.Fatalf("Peek() got %d bytes, err %v", len(peeked), err)
+	}
+
+	buf := make([]byte, 4096)
+	for pb.Buffered() > 64<<10 {
+		if _, err := pb.Read(buf); err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+
+	if got := cap(pb.buffer); got >= size/2 {
+		t.Errorf("retained capacity = %d after reading most of the buffer, want < %d", got, size/2)
+	}
+
+	remaining, err := io.ReadAll(pb)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if len(remaining) != 64<<10 {
+		t.Errorf("ReadAll() got %d bytes, want %d", len(remaining), 64<<10)
+	}
+}
+
+func benchmarkInput() []byte {
+	input := make([]byte, 1<<20) // 1 MB of data
+	for i := range input {
+		input[i] = byte(i % 256)
+	}
+	return input
+}
+
+func BenchmarkPeekBuffer_PeekRead(b *testing.B) {
+	input := benchmarkInput()
+	reader := bytes.NewReader(input)
+	buf := make([]byte, 48)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(input)
+		pb := NewPeekBuffer(reader)
+		for {
+			if peeked, _ := pb.Peek(64); len(peeked) == 0 {
+				break
+			}
+			if _, err := io.ReadFull(pb, buf); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkPeekBuffer_GrowingPeek(b *testing.B) {
+	input := benchmarkInput()
+	reader := bytes.NewReader(input)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(input)
+		pb := NewPeekBuffer(reader)
+		for size := 1024; size <= len(input); size += 1024 {
+			pb.Peek(size)
+		}
+	}
+}
+
+func BenchmarkPeekBuffer_PeekUntilGrowth(b *testing.B) {
+	// The delimiter is the last byte, so the whole stream is buffered by one growing scan
+	input := bytes.Repeat([]byte{'a'}, 1<<20)
+	input[len(input)-1] = '\n'
+
+	for _, factor := range []float64{1, 2} {
+		b.Run(fmt.Sprintf("Factor %g", factor), func(b *testing.B) {
+			reader := bytes.NewReader(input)
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				reader.Reset(input)
+				pb := New(reader, WithGrowthFactor(factor))
+				if peeked, err := pb.PeekUntil('\n'); err != nil || len(peeked) != len(input) {
+					b.Fatalf("PeekUntil() got %d bytes, err %v", len(peeked), err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPeekBuffer_ReadByte(b *testing.B) {
+	input := benchmarkInput()
+	reader := bytes.NewReader(input)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(input)
+		pb := NewPeekBuffer(reader)
+		for {
+			if _, err := pb.ReadByte(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkPeekBuffer_ReadByteWarm(b *testing.B) {
+	input := benchmarkInput()
+	reader := bytes.NewReader(input)
+	// Reusing the PeekBuffer keeps its buffer, so only the per-byte cost is measured
+	pb := NewPeekBuffer(reader)
+	pb.Peek(1)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(input)
+		pb.Reset(reader)
+		for {
+			if _, err := pb.ReadByte(); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func TestPeekBuffer_MaxBuffer(t *testing.T) {
+	const input = "hello world"
+
+	tests := []struct {
+		name    string
+		maxSize int
+		size    int
+		want    string
+		wantErr error
+	}{
+		{"Within limit", 8, 5, "hello", nil},
+		{"At limit", 8, 8, "hello wo", nil},
+		{"Over limit", 8, 9, "hello wo", ErrBufferFull},
+		{"Far over limit", 4, 1 << 30, "hell", ErrBufferFull},
+		{"Over limit at EOF", 20, 30, "hello world", nil},
+		{"No limit", 0, 30, "hello world", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), 3)
+			pb.SetMaxBuffer(tt.maxSize)
+
+			got, err := pb.Peek(tt.size)
+			if err != tt.wantErr {
+				t.Errorf("Peek(%d) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Peek(%d) got = %v, want %v", tt.size, string(got), tt.want)
+			}
+			if tt.maxSize > 0 && pb.Buffered() > tt.maxSize {
+				t.Errorf("Buffered() = %d, exceeds limit %d", pb.Buffered(), tt.maxSize)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != input {
+				t.Errorf("ReadAll() got = %v, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Peeked(t *testing.T) {
+	pb := NewPeekBufferSize(&ResumingReader{chunks: [][]byte{[]byte("hello"), []byte(" world")}}, 3)
+	if got := pb.Peeked(); len(got) != 0 {
+		t.Errorf("Peeked() before Peek got = %q, want empty", got)
+	}
+
+	pb.Peek(2)
+	if got := pb.Peeked(); string(got) != "hel" {
+		t.Errorf("Peeked() got = %q, want %q", got, "hel")
+	}
+	pb.Discard(1)
+	if got := pb.Peeked(); string(got) != "el" {
+		t.Errorf("Peeked() after Discard got = %q, want %q", got, "el")
+	}
+	if pb.Buffered() != 2 {
+		t.Errorf("Peeked() read from the reader, Buffered() got = %v, want 2", pb.Buffered())
+	}
+}
+
+func TestPeekBuffer_Buffers(t *testing.T) {
+	pb := NewPeekBufferSize(strings.NewReader("hello world"), 4)
+	if got := pb.Buffers(); got != nil {
+		t.Errorf("Buffers() before Peek got = %q, want nil", got)
+	}
+
+	pb.Peek(6)
+	pb.Discard(1)
+	want := string(pb.Peeked())
+	buffers := pb.Buffers()
+	var out bytes.Buffer
+	n, err := buffers.WriteTo(&out)
+	if err != nil || out.String() != want {
+		t.Errorf("Buffers().WriteTo() got = %q, err %v, want %q", out.String(), err, want)
+	}
+	if pb.Buffered() != int(n) {
+		t.Errorf("Buffers() consumed data, Buffered() got = %v, want %v", pb.Buffered(), n)
+	}
+
+	pb.Discard(int(n))
+	if got, _ := io.ReadAll(pb); want+string(got) != "ello world" {
+		t.Errorf("ReadAll() after flushing Buffers got = %q, want the rest of %q", got, "ello world")
+	}
+}
+
+func TestPeekBuffer_String(t *testing.T) {
+	pb := NewPeekBuffer(&ErrorReader{err: errors.New("String read from the reader")})
+	if got, want := pb.String(), "PeekBuffer{buffered: 0, capacity: 0, offset: 0, data: ||}"; got != want {
+		t.Errorf("String() got = %q, want %q", got, want)
+	}
+
+	pb = NewPeekBufferSize(bytes.NewReader([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n")), 64)
+	pb.Discard(4)
+	pb.Peek(1)
+	want := "PeekBuffer{buffered: 31, capacity: 64, offset: 4, data: 2f 20 48 54 54 50 2f 31 2e 31 0d 0a 48 6f 73 74 ... |/ HTTP/1.1..Host|}"
+	if got := pb.String(); got != want {
+		t.Errorf("String() got = %q, want %q", got, want)
+	}
+	if got := fmt.Sprint(pb); got != want {
+		t.Errorf("fmt.Sprint() got = %q, want %q", got, want)
+	}
+}
+
+func TestPeekBuffer_DumpBuffered(t *testing.T) {
+	input := "GET / HTTP/1.1\r\nHost: example.com\r\n"
+
+	tests := []struct {
+		name    string
+		discard int
+		peek    int
+		want    string
+	}{
+		{"Empty", 0, 0, ""},
+		{"After discard", 4, 1, hex.Dump([]byte(input[4:]))},
+		{"Multiple lines", 0, 1, "" +
+			"00000000  47 45 54 20 2f 20 48 54  54 50 2f 31 2e 31 0d 0a  |GET / HTTP/1.1..|\n" +
+			"00000010  48 6f 73 74 3a 20 65 78  61 6d 70 6c 65 2e 63 6f  |Host: example.co|\n" +
+			"00000020  6d 0d 0a                                          |m..|\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(strings.NewReader(input), 64)
+			pb.Discard(tt.discard)
+			pb.Peek(tt.peek)
+			buffered, offset := pb.Buffered(), pb.Offset()
+			pb.reader = PanicReader{}
+
+			var out strings.Builder
+			if err := pb.DumpBuffered(&out); err != nil {
+				t.Fatalf("DumpBuffered() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("DumpBuffered() got:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+			if pb.Buffered() != buffered || pb.Offset() != offset {
+				t.Errorf("DumpBuffered() changed Buffered() to %d and Offset() to %d, want %d and %d",
+					pb.Buffered(), pb.Offset(), buffered, offset)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_DumpBufferedWriteError(t *testing.T) {
+	pb := NewPeekBuffer(strings.NewReader("hello world"))
+	pb.Peek(5)
+	if err := pb.DumpBuffered(&FailingWriter{}); err == nil {
+		t.Error("DumpBuffered() error = nil, want the write error")
+	}
+	if pb.Buffered() != 11 {
+		t.Errorf("Buffered() = %d, want 11", pb.Buffered())
+	}
+}
+
+func TestPeekBuffer_PeekUntil(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		fillSize int
+		maxSize  int
+		want     string
+		wantErr  error
+	}{
+		{"Delimiter in first fill", "hello\nworld", 4096, 0, "hello\n", nil},
+		{"Delimiter across fills", "hello world\nnext", 3, 0, "hello world\n", nil},
+		{"Delimiter first", "\nhello", 3, 0, "\n", nil},
+		{"Delimiter last", "hello\n", 3, 0, "hello\n", nil},
+		{"No delimiter", "hello world", 3, 0, "hello world", io.EOF},
+		{"Empty", "", 3, 0, "", io.EOF},
+		{"Buffer full", "hello world\n", 3, 5, "hello", ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), tt.fillSize)
+			pb.SetMaxBuffer(tt.maxSize)
+
+			got, err := pb.PeekUntil('\n')
+			if err != tt.wantErr {
+				t.Errorf("PeekUntil() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("PeekUntil() got = %q, want %q", string(got), tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekUntilFunc(t *testing.T) {
+	isSpace := func(b byte) bool { return b == ' ' || b == '\n' }
+
+	tests := []struct {
+		name     string
+		input    string
+		fillSize int
+		maxSize  int
+		want     string
+		wantErr  error
+	}{
+		{"Match in first fill", "hello world", 4096, 0, "hello", nil},
+		{"Match across fills", "helloworld next", 3, 0, "helloworld", nil},
+		{"Match first", " hello", 3, 0, "", nil},
+		{"Match last", "hello\n", 3, 0, "hello", nil},
+		{"No match", "helloworld", 3, 0, "helloworld", io.EOF},
+		{"Empty", "", 3, 0, "", io.EOF},
+		{"Buffer full", "helloworld ", 3, 5, "hello", ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), tt.fillSize)
+			pb.SetMaxBuffer(tt.maxSize)
+
+			calls := 0
+			got, err := pb.PeekUntilFunc(func(b byte) bool {
+				calls++
+				return isSpace(b)
+			})
+			if err != tt.wantErr {
+				t.Errorf("PeekUntilFunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("PeekUntilFunc() got = %q, want %q", string(got), tt.want)
+			}
+			if calls > pb.Buffered() {
+				t.Errorf("PeekUntilFunc() called pred %d times for %d buffered bytes", calls, pb.Buffered())
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_ReadSlice(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("one\ntwo\nthree")), 3)
+
+	for _, want := range []struct {
+		line string
+		err  error
+	}{
+		{"one\n", nil},
+		{"two\n", nil},
+		{"three", io.EOF},
+		{"", io.EOF},
+	} {
+		line, err := pb.ReadSlice('\n')
+		if err != want.err {
+			t.Errorf("ReadSlice() error = %v, wantErr %v", err, want.err)
+		}
+		if string(line) != want.line {
+			t.Errorf("ReadSlice() got = %q, want %q", string(line), want.line)
+		}
+	}
+}
+
+func TestPeekBuffer_ReadSliceBufferFull(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("hello world\nnext\n")), 4)
+	pb.SetMaxBuffer(8)
+
+	line, err := pb.ReadSlice('\n')
+	if err != ErrBufferFull || string(line) != "hello wo" {
+		t.Errorf("ReadSlice() got = %q, err %v, want %q, %v", string(line), err, "hello wo", ErrBufferFull)
+	}
+	line, err = pb.ReadSlice('\n')
+	if err != nil || string(line) != "rld\n" {
+		t.Errorf("ReadSlice() got = %q, err %v, want %q", string(line), err, "rld\n")
+	}
+}
+
+func TestPeekBuffer_ReadString(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		peek    int
+		maxSize int
+		want    string
+		wantErr error
+	}{
+		{"Line", "hello\nworld", 0, 0, "hello\n", nil},
+		{"Line after peek", "hello\nworld", 3, 0, "hello\n", nil},
+		{"Longer than max buffer", "hello world\nnext", 0, 4, "hello world\n", nil},
+		{"No delimiter", "hello world", 0, 0, "hello world", io.EOF},
+		{"Empty", "", 0, 0, "", io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), 2)
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+			pb.SetMaxBuffer(tt.maxSize)
+
+			got, err := pb.ReadString('\n')
+			if err != tt.wantErr {
+				t.Errorf("ReadString() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadString() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_ReadLine(t *testing.T) {
+	type lineTest struct {
+		line     string
+		isPrefix bool
+		err      error
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		maxSize int
+		lines   []lineTest
+	}{
+		{"LF", "one\ntwo\n", 0, []lineTest{{"one", false, nil}, {"two", false, nil}, {"", false, io.EOF}}},
+		{"CRLF", "one\r\ntwo\r\n", 0, []lineTest{{"one", false, nil}, {"two", false, nil}, {"", false, io.EOF}}},
+		{"No final newline", "one\ntwo", 0, []lineTest{{"one", false, nil}, {"two", false, nil}, {"", false, io.EOF}}},
+		{"Empty lines", "\n\r\n", 0, []lineTest{{"", false, nil}, {"", false, nil}, {"", false, io.EOF}}},
+		{"Bare CR", "one\rtwo\n", 0, []lineTest{{"one\rtwo", false, nil}, {"", false, io.EOF}}},
+		{"Bare CR at EOF", "one\r", 0, []lineTest{{"one\r", false, nil}, {"", false, io.EOF}}},
+		{"Prefix", "abcdefgh\n", 4, []lineTest{{"abcd", true, nil}, {"efgh", true, nil}, {"", false, nil}, {"", false, io.EOF}}},
+		{"CR at end of buffer", "abc\r\ndef\n", 4, []lineTest{{"abc", true, nil}, {"", false, nil}, {"def", false, nil}, {"", false, io.EOF}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), 2)
+			pb.SetMaxBuffer(tt.maxSize)
+
+			for _, want := range tt.lines {
+				line, isPrefix, err := pb.ReadLine()
+				if err != want.err {
+					t.Errorf("ReadLine() error = %v, wantErr %v", err, want.err)
+				}
+				if string(line) != want.line || isPrefix != want.isPrefix {
+					t.Errorf("ReadLine() got = %q, %v, want %q, %v", string(line), isPrefix, want.line, want.isPrefix)
+				}
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Lines(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		fillSize int
+		want     []string
+	}{
+		{"Lines", "one\ntwo\r\nthree\n", 4096, []string{"one", "two", "three"}},
+		{"No trailing newline", "one\ntwo", 4096, []string{"one", "two"}},
+		{"Empty lines", "\n\r\n\n", 4096, []string{"", "", ""}},
+		{"Across fills", "first line\nsecond line\r\n", 3, []string{"first line", "second line"}},
+		{"Empty", "", 4096, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), tt.fillSize)
+			var got []string
+			err := pb.Lines(func(line []byte) bool {
+				got = append(got, string(line))
+				return true
+			})
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() got = %q, err %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_LinesStop(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("one\ntwo\nthree\n")))
+	var got []string
+	err := pb.Lines(func(line []byte) bool {
+		got = append(got, string(line))
+		return len(got) < 2
+	})
+	if err != nil || !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("Lines() got = %q, err %v", got, err)
+	}
+	if remaining, err := io.ReadAll(pb); err != nil || string(remaining) != "three\n" {
+		t.Errorf("ReadAll() after Lines got = %q, err %v", remaining, err)
+	}
+
+	pb = NewPeekBuffer(bytes.NewReader([]byte("a long line\n")))
+	pb.SetMaxBuffer(4)
+	if err := pb.Lines(func([]byte) bool { return true }); err != ErrBufferFull {
+		t.Errorf("Lines() error = %v, want %v", err, ErrBufferFull)
+	}
+}
+
+func TestPeekBuffer_LinesAllocs(t *testing.T) {
+	input := bytes.Repeat([]byte("a log line of moderate length\n"), 1000)
+	reader := bytes.NewReader(input)
+	pb := NewPeekBuffer(reader)
+	allocs := testing.AllocsPerRun(10, func() {
+		reader.Reset(input)
+		pb.Reset(reader)
+		pb.Lines(func([]byte) bool { return true })
+	})
+	if allocs != 0 {
+		t.Errorf("Lines() allocated %v times per run, want 0", allocs)
+	}
+}
+
+func TestPeekBuffer_ReadRune(t *testing.T) {
+	const input = "aé€\U0001f600\xffz"
+	want := []struct {
+		r    rune
+		size int
+	}{
+		{'a', 1},
+		{'é', 2},
+		{'€', 3},
+		{'\U0001f600', 4},
+		{utf8.RuneError, 1},
+		{'z', 1},
+	}
+
+	// Small fill sizes force multi-byte runes to straddle fill boundaries.
+	for _, fillSize := range []int{1, 2, 3, 4096} {
+		pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), fillSize)
+		for _, w := range want {
+			r, size, err := pb.PeekRune()
+			if err != nil || r != w.r || size != w.size {
+				t.Errorf("PeekRune() with fill size %d got = %q, %d, %v, want %q, %d", fillSize, r, size, err, w.r, w.size)
+			}
+			r, size, err = pb.ReadRune()
+			if err != nil || r != w.r || size != w.size {
+				t.Errorf("ReadRune() with fill size %d got = %q, %d, %v, want %q, %d", fillSize, r, size, err, w.r, w.size)
+			}
+		}
+		if _, _, err := pb.ReadRune(); err != io.EOF {
+			t.Errorf("ReadRune() at end with fill size %d error = %v, want %v", fillSize, err, io.EOF)
+		}
+	}
+}
+
+func TestPeekBuffer_ReadRuneTruncated(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("\xe2\x82")))
+	for i := 0; i < 2; i++ {
+		r, size, err := pb.ReadRune()
+		if err != nil || r != utf8.RuneError || size != 1 {
+			t.Errorf("ReadRune() got = %q, %d, %v, want %q, 1, nil", r, size, err, utf8.RuneError)
+		}
+	}
+	if _, _, err := pb.ReadRune(); err != io.EOF {
+		t.Errorf("ReadRune() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestPeekBuffer_PeekRuneAt(t *testing.T) {
+	const input = "aé€\U0001f600\xffz"
+	want := []struct {
+		offset int
+		r      rune
+		size   int
+	}{
+		{0, 'a', 1},
+		{1, 'é', 2},
+		{2, utf8.RuneError, 1},
+		{3, '€', 3},
+		{6, '\U0001f600', 4},
+		{10, utf8.RuneError, 1},
+		{11, 'z', 1},
+	}
+
+	// Small fill sizes force multi-byte runes to straddle fill boundaries.
+	for _, fillSize := range []int{1, 2, 3, 4096} {
+		pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), fillSize)
+		for _, w := range want {
+			r, size, err := pb.PeekRuneAt(w.offset)
+			if err != nil || r != w.r || size != w.size {
+				t.Errorf("PeekRuneAt(%d) with fill size %d got = %q, %d, %v, want %q, %d", w.offset, fillSize, r, size, err, w.r, w.size)
+			}
+		}
+		if _, _, err := pb.PeekRuneAt(12); err != io.EOF {
+			t.Errorf("PeekRuneAt(12) with fill size %d error = %v, want %v", fillSize, err, io.EOF)
+		}
+		if _, _, err := pb.PeekRuneAt(100); err != io.EOF {
+			t.Errorf("PeekRuneAt(100) with fill size %d error = %v, want %v", fillSize, err, io.EOF)
+		}
+		if _, _, err := pb.PeekRuneAt(-1); err != ErrNegativeOffset {
+			t.Errorf("PeekRuneAt(-1) with fill size %d error = %v, want %v", fillSize, err, ErrNegativeOffset)
+		}
+		if pb.Offset() != 0 {
+			t.Errorf("PeekRuneAt() with fill size %d consumed %d bytes", fillSize, pb.Offset())
+		}
+	}
+}
+
+func TestPeekBuffer_Unread(t *testing.T) {
+	const input = "hello world"
+
+	tests := []struct {
+		name   string
+		peek   int
+		read   int
+		unread string
+		want   string
+	}{
+		{"Unread read bytes", 0, 5, "hello", "hello world"},
+		{"Unread after peek", 8, 5, "hello", "hello world"},
+		{"Unread partial", 0, 6, "o ", "o world"},
+		{"Unread other bytes", 11, 6, "big ", "big world"},
+		{"Unread nothing", 0, 6, "", "world"},
+		{"Unread into empty buffer", 0, 11, "world", "world"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(input)))
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+			if _, err := io.ReadFull(pb, make([]byte, tt.read)); err != nil {
+				t.Fatalf("ReadFull() error = %v", err)
+			}
+
+			if err := pb.Unread([]byte(tt.unread)); err != nil {
+				t.Fatalf("Unread() error = %v", err)
+			}
+
+			got, err := io.ReadAll(pb)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(got), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Prepend(t *testing.T) {
+	tests := []struct {
+		name     string
+		peek     int
+		read     int
+		prepends []string
+		want     string
+	}{
+		{"Before buffered data", 8, 6, []string{"big "}, "big world"},
+		{"Nothing buffered", 0, 6, []string{"big "}, "big world"},
+		{"Replace header", 11, 5, []string{"HELLO"}, "HELLO world"},
+		{"Later prepend first", 8, 6, []string{"world", "big "}, "big worldworld"},
+		{"Empty", 8, 6, []string{""}, "world"},
+		{"End of stream", 11, 11, []string{"!"}, "!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+			pb.Peek(tt.peek)
+			if _, err := io.ReadFull(pb, make([]byte, tt.read)); err != nil {
+				t.Fatalf("ReadFull() error = %v", err)
+			}
+
+			injected := 0
+			for _, p := range tt.prepends {
+				buf := []byte(p)
+				pb.Prepend(buf)
+				// The bytes are copied
+				copy(buf, "XXXXXXXXXX")
+				injected += len(p)
+			}
+			if got := pb.Offset(); got != int64(tt.read-injected) {
+				t.Errorf("Offset() after Prepend = %d, want %d", got, tt.read-injected)
+			}
+
+			got, err := io.ReadAll(pb)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(got), err, tt.want)
+			}
+			if pb.Offset() != 11 {
+				t.Errorf("Offset() after ReadAll = %d, want 11", pb.Offset())
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PrependRetained(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(pb *PeekBuffer) func() error
+		offset int64
+		want   string
+	}{
+		{"History", func(pb *PeekBuffer) func() error { return nil }, 1, "XYdef"},
+		{"Mark", func(pb *PeekBuffer) func() error {
+			pb.Mark()
+			return pb.Rewind
+		}, -2, "abcXYdef"},
+		{"Snapshot", func(pb *PeekBuffer) func() error {
+			s := pb.Snapshot()
+			return func() error { return pb.Restore(s) }
+		}, -2, "abcXYdef"},
+		{"Recording", func(pb *PeekBuffer) func() error {
+			pb.recording = true
+			return pb.RewindAll
+		}, -2, "abcXYdef"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := New(bytes.NewReader([]byte("abcdef")), WithHistory(8))
+			rewind := tt.setup(pb)
+			pb.Discard(3)
+			pb.Prepend([]byte("XY"))
+
+			// The injected bytes come after the consumed bytes rather than replacing them
+			if got := pb.History(); string(got) != "abc" {
+				t.Errorf("History() after Prepend got = %q, want %q", got, "abc")
+			}
+			if rewind != nil {
+				if err := rewind(); err != nil {
+					t.Fatalf("rewind error = %v", err)
+				}
+			}
+			if got := pb.Offset(); got != tt.offset {
+				t.Errorf("Offset() got = %d, want %d", got, tt.offset)
+			}
+			if got, err := io.ReadAll(pb); err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PrependBeyondMaxBuffer(t *testing.T) {
+	pb := New(bytes.NewReader([]byte("hello world")), WithMaxBuffer(8))
+	if _, err := pb.Peek(5); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	pb.Prepend([]byte("12345"))
+
+	if peeked, err := pb.Peek(10); err != nil || string(peeked) != "12345hello" {
+		t.Errorf("Peek(10) got = %q, err %v, want %q, nil", peeked, err, "12345hello")
+	}
+	// Everything buffered stays visible beyond the maximum buffer size, but nothing more is read
+	if peeked, err := pb.Peek(20); err != ErrBufferFull || string(peeked) != "12345hello wo" {
+		t.Errorf("Peek(20) got = %q, err %v, want %q, %v", peeked, err, "12345hello wo", ErrBufferFull)
+	}
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "12345hello world" {
+		t.Errorf("ReadAll() got = %q, err %v", got, err)
+	}
+}
+
+func TestPeekBuffer_UnreadBufferFull(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	pb.SetMaxBuffer(8)
+	if _, err := pb.Peek(5); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	if err := pb.Unread([]byte("1234")); err != ErrBufferFull {
+		t.Errorf("Unread() error = %v, want %v", err, ErrBufferFull)
+	}
+}
+
+// CloseReader is a mock reader that records whether it was closed
+type CloseReader struct {
+	io.Reader
+	closed bool
+	err    error
+}
+
+func (c *CloseReader) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestPeekBuffer_Close(t *testing.T) {
+	closeErr := errors.New("close error")
+	reader := &CloseReader{Reader: bytes.NewReader([]byte("test")), err: closeErr}
+
+	var rc io.ReadCloser = NewPeekBuffer(reader)
+	if err := rc.Close(); err != closeErr {
+		t.Errorf("Close() error = %v, want %v", err, closeErr)
+	}
+	if !reader.closed {
+		t.Error("Close() did not close the underlying reader")
+	}
+
+	if err := NewPeekBuffer(bytes.NewReader([]byte("test"))).Close(); err != nil {
+		t.Errorf("Close() on non-closer error = %v, want nil", err)
+	}
+}
+
+func TestPeekBuffer_Unwrap(t *testing.T) {
+	reader := bytes.NewReader([]byte("test"))
+	pb := NewPeekBuffer(reader)
+	if got := pb.Unwrap(); got != reader {
+		t.Errorf("Unwrap() got = %v, want %v", got, reader)
+	}
+}
+
+func TestPeekBuffer_Detach(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		consume int
+		peek    int
+		want    string
+		wantErr error
+	}{
+		{"Nothing buffered", strings.NewReader("hello world"), 0, 0, "hello world", nil},
+		{"Peeked data replayed", strings.NewReader("hello world"), 0, 5, "hello world", nil},
+		{"Consumed data skipped", strings.NewReader("hello world"), 3, 5, "lo world", nil},
+		{"One byte reads", iotest.OneByteReader(strings.NewReader("hello world")), 2, 3, "llo world", nil},
+		{"Sticky error", &DataErrorReader{data: []byte("hello"), err: readErr}, 1, 5, "ello", readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader)
+			if _, err := pb.Discard(tt.consume); err != nil {
+				t.Fatalf("Discard() error = %v", err)
+			}
+			pb.Peek(tt.peek)
+
+			detached := pb.Detach()
+			// The replayed data is a copy, so changes to the buffer don't affect it
+			copy(pb.Peeked(), "XXXXXXXXXXX")
+
+			got, err := io.ReadAll(detached)
+			if err != tt.wantErr {
+				t.Errorf("ReadAll() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadAll() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Seek(t *testing.T) {
+	input := []byte("hello world")
+
+	tests := []struct {
+		name    string
+		offset  int64
+		whence  int
+		wantPos int64
+	}{
+		{"Start", 2, io.SeekStart, 2},
+		{"Current", 2, io.SeekCurrent, 6},
+		{"Current backwards", -4, io.SeekCurrent, 0},
+		{"End", -3, io.SeekEnd, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader(input))
+			if _, err := pb.Discard(4); err != nil {
+				t.Fatalf("Discard() error = %v", err)
+			}
+			if _, err := pb.Peek(5); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+
+			pos, err := pb.Seek(tt.offset, tt.whence)
+			if err != nil || pos != tt.wantPos {
+				t.Fatalf("Seek() got = %v, err %v, want %v", pos, err, tt.wantPos)
+			}
+			if got := pb.Offset(); got != tt.wantPos {
+				t.Errorf("Offset() after Seek got = %v, want %v", got, tt.wantPos)
+			}
+			got, err := io.ReadAll(pb)
+			if err != nil || string(got) != string(input[tt.wantPos:]) {
+				t.Errorf("ReadAll() after Seek got = %q, err %v, want %q", got, err, input[tt.wantPos:])
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_SeekErrors(t *testing.T) {
+	pb := NewPeekBuffer(strings.NewReader("hello"))
+	pb.Mark()
+	pb.Discard(1)
+	if _, err := pb.Seek(-10, io.SeekCurrent); err == nil {
+		t.Error("Seek() before the start of the stream got no error")
+	}
+	if err := pb.Rewind(); err != nil {
+		t.Errorf("Rewind() after failed Seek error = %v", err)
+	}
+
+	pb = NewPeekBuffer(&ErrorReader{})
+	if _, err := pb.Seek(0, io.SeekStart); err != ErrNotSeeker {
+		t.Errorf("Seek() error = %v, want %v", err, ErrNotSeeker)
+	}
+}
+
+func TestPeekBuffer_ReadAt(t *testing.T) {
+	input := "hello world"
+
+	tests := []struct {
+		name    string
+		marked  bool
+		off     int64
+		size    int
+		want    string
+		wantErr error
+	}{
+		{"Buffered", false, 4, 3, "o w", nil},
+		{"Beyond buffered", false, 6, 5, "world", nil},
+		{"Past end", false, 8, 5, "rld", io.EOF},
+		{"After end", false, 20, 5, "", io.EOF},
+		{"Empty", false, 20, 0, "", nil},
+		{"Consumed", false, 1, 3, "", ErrOffsetConsumed},
+		{"Retained", true, 1, 3, "ell", nil},
+		{"Before retained", true, 0, 3, "", ErrOffsetConsumed},
+		{"Negative", false, -1, 3, "", ErrNegativeOffset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(strings.NewReader(input), 4)
+			pb.Discard(1)
+			if tt.marked {
+				pb.Mark()
+			}
+			pb.Discard(2)
+			pb.Peek(3)
+
+			p := make([]byte, tt.size)
+			n, err := pb.ReadAt(p, tt.off)
+			if err != tt.wantErr || string(p[:n]) != tt.want {
+				t.Errorf("ReadAt() got = %q, err %v, want %q, err %v", p[:n], err, tt.want, tt.wantErr)
+			}
+			if got, _ := io.ReadAll(pb); string(got) != input[3:] {
+				t.Errorf("ReadAll() after ReadAt got = %q, want %q", got, input[3:])
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Innermost(t *testing.T) {
+	reader := bytes.NewReader([]byte("test"))
+	inner := NewPeekBuffer(reader)
+	outer := NewPeekBuffer(NewPeekBuffer(inner))
+	if got := outer.Innermost(); got != reader {
+		t.Errorf("Innermost() got = %v, want %v", got, reader)
+	}
+	if got := inner.Innermost(); got != reader {
+		t.Errorf("Innermost() without stacking got = %v, want %v", got, reader)
+	}
+
+	var r io.Reader = outer
+	if pb, ok := r.(interface{ IsPeekBuffer() bool }); !ok || !pb.IsPeekBuffer() {
+		t.Error("IsPeekBuffer() not detected through an interface assertion")
+	}
+}
+
+func TestAsPeekBuffer(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if _, err := pb.Peek(5); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	if got := AsPeekBuffer(pb); got != pb {
+		t.Errorf("AsPeekBuffer() wrapped an existing PeekBuffer")
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewPeekConn(server)
+	defer conn.Close()
+	if got := AsPeekBuffer(conn); got != conn.PeekBuffer {
+		t.Errorf("AsPeekBuffer() did not unwrap a PeekConn")
+	}
+
+	reader := bytes.NewReader([]byte("hello"))
+	if got := AsPeekBuffer(reader); got.Unwrap() != reader {
+		t.Errorf("AsPeekBuffer() got = %v, want a PeekBuffer wrapping the reader", got)
+	}
+}
+
+func TestPeekBuffer_PeekDelimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		open     byte
+		close    byte
+		fillSize int
+		maxSize  int
+		want     string
+		wantErr  error
+	}{
+		{"Flat", "(abc) rest", '(', ')', 4096, 0, "(abc)", nil},
+		{"Nested", "(a (b) (c (d))) rest", '(', ')', 4096, 0, "(a (b) (c (d)))", nil},
+		{"Nested across fills", "{a{b}{c{d}}}{e}", '{', '}', 2, 0, "{a{b}{c{d}}}", nil},
+		{"Empty region", "()", '(', ')', 4096, 0, "()", nil},
+		{"Same delimiter", `"abc" "def"`, '"', '"', 2, 0, `"abc"`, nil},
+		{"Unbalanced", "(a (b)", '(', ')', 2, 0, "(a (b)", io.ErrUnexpectedEOF},
+		{"Not delimited", "a(b)", '(', ')', 4096, 0, "", ErrNotDelimited},
+		{"Close first", ")(", '(', ')', 4096, 0, "", ErrNotDelimited},
+		{"Empty", "", '(', ')', 4096, 0, "", io.EOF},
+		{"Buffer full", "(abcdef)", '(', ')', 2, 4, "(abc", ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(strings.NewReader(tt.input), tt.fillSize)
+			pb.SetMaxBuffer(tt.maxSize)
+
+			got, err := pb.PeekDelimited(tt.open, tt.close)
+			if err != tt.wantErr || string(got) != tt.want {
+				t.Errorf("PeekDelimited() got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+			if all, _ := io.ReadAll(pb); string(all) != tt.input {
+				t.Errorf("ReadAll() after PeekDelimited got = %q, want %q", all, tt.input)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekAll(t *testing.T) {
+	input := benchmarkInput()[:100000]
+
+	pb := NewPeekBuffer(bytes.NewReader(input))
+	if _, err := pb.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	peeked, err := pb.PeekAll()
+	if err != nil || !bytes.Equal(peeked, input[10:]) {
+		t.Errorf("PeekAll() got %d bytes, err %v, want %d bytes", len(peeked), err, len(input)-10)
+	}
+
+	got, err := io.ReadAll(pb)
+	if err != nil || !bytes.Equal(got, input[10:]) {
+		t.Errorf("ReadAll() got %d bytes, err %v, want %d bytes", len(got), err, len(input)-10)
+	}
+}
+
+func TestPeekBuffer_PeekAllBufferFull(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	pb.SetMaxBuffer(5)
+
+	peeked, err := pb.PeekAll()
+	if err != ErrBufferFull || string(peeked) != "hello" {
+		t.Errorf("PeekAll() got = %q, err %v, want %q, %v", string(peeked), err, "hello", ErrBufferFull)
+	}
+}
+
+// PanicReader is a mock reader that panics if it is read from
+type PanicReader struct{}
+
+func (PanicReader) Read(p []byte) (int, error) {
+	panic("unexpected read from the underlying reader")
+}
+
+func TestPeekBuffer_PeekZero(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func() *PeekBuffer
+	}{
+		{"Empty buffer", func() *PeekBuffer { return NewPeekBuffer(PanicReader{}) }},
+		{"Buffered data", func() *PeekBuffer {
+			pb := NewPeekBuffer(bytes.NewReader([]byte("hello")))
+			pb.Peek(5)
+			pb.reader = PanicReader{}
+			return pb
+		}},
+		{"Sticky error", func() *PeekBuffer {
+			pb := NewPeekBuffer(&ErrorReader{err: errors.New("read failed")})
+			pb.Peek(1)
+			pb.reader = PanicReader{}
+			return pb
+		}},
+		{"Strict EOF", func() *PeekBuffer { return New(PanicReader{}, WithStrictEOF()) }},
+		{"Maximum buffer size", func() *PeekBuffer { return New(PanicReader{}, WithMaxBuffer(4)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := tt.setup()
+			buffered := pb.Buffered()
+			got, err := pb.Peek(0)
+			if len(got) != 0 || err != nil {
+				t.Errorf("Peek(0) got = %q, err %v, want empty, nil", got, err)
+			}
+			if pb.Buffered() != buffered {
+				t.Errorf("Peek(0) changed Buffered() from %d to %d", buffered, pb.Buffered())
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_EnsureBuffered(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		n        int
+		maxSize  int
+		wantErr  error
+		buffered int
+	}{
+		{"Enough data", "hello world", 5, 0, nil, 11},
+		{"Exact", "hello", 5, 0, nil, 5},
+		{"Truncated", "hel", 5, 0, io.ErrUnexpectedEOF, 3},
+		{"Empty", "", 5, 0, io.ErrUnexpectedEOF, 0},
+		{"Zero", "", 0, 0, nil, 0},
+		{"Buffer full", "hello world", 8, 4, ErrBufferFull, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			pb.SetMaxBuffer(tt.maxSize)
+			if err := pb.EnsureBuffered(tt.n); err != tt.wantErr {
+				t.Errorf("EnsureBuffered() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := pb.Buffered(); got != tt.buffered {
+				t.Errorf("Buffered() got = %v, want %v", got, tt.buffered)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Grow(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if _, err := pb.Peek(5); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+
+	pb.Grow(64 << 10)
+	if free := len(pb.buffer) - pb.tail; free < 64<<10 {
+		t.Errorf("Grow() left room for %d bytes, want at least %d", free, 64<<10)
+	}
+	if got := pb.Buffered(); got != 11 {
+		t.Errorf("Buffered() after Grow got = %v, want 11", got)
+	}
+
+	buffer := pb.buffer
+	if _, err := pb.Peek(64 << 10); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	if &pb.buffer[0] != &buffer[0] {
+		t.Error("Peek() reallocated the buffer after Grow")
+	}
+
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v", string(got), err)
+	}
+}
+
+func TestPeekBuffer_GrowOverMaxBuffer(t *testing.T) {
+	input := benchmarkInput()[:30]
+
+	tests := []struct {
+		name  string
+		setup func() *PeekBuffer
+		want  []byte
+	}{
+		{"SetMaxBuffer below buffered", func() *PeekBuffer {
+			pb := NewPeekBufferSize(bytes.NewReader(input), 20)
+			pb.Peek(20)
+			pb.SetMaxBuffer(10)
+			pb.Grow(5)
+			return pb
+		}, input},
+		{"Prepend over max buffer", func() *PeekBuffer {
+			pb := New(bytes.NewReader(input), WithMaxBuffer(4), WithFillSize(4))
+			pb.Peek(4)
+			pb.Prepend([]byte("012345"))
+			pb.Grow(4)
+			return pb
+		}, append([]byte("012345"), input...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := tt.setup()
+			got, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(got, tt.want) {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_GrowKeptOnceDrained(t *testing.T) {
+	input := benchmarkInput()[:5000]
+
+	tests := []struct {
+		name  string
+		setup func() *PeekBuffer
+	}{
+		{"Grow", func() *PeekBuffer {
+			pb := New(bytes.NewReader(input), WithFillSize(16))
+			pb.Grow(1024)
+			return pb
+		}},
+		{"WithInitialCapacity", func() *PeekBuffer {
+			return New(bytes.NewReader(input), WithFillSize(16), WithInitialCapacity(1024))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := tt.setup()
+			buffer := pb.buffer
+			for i := 0; i < 3; i++ {
+				if _, err := pb.Peek(1000); err != nil {
+					t.Fatalf("Peek() error = %v", err)
+				}
+				// Reading byte by byte neither compacts the array nor releases it once drained
+				for j := 0; j < 1000; j++ {
+					if b, err := pb.ReadByte(); err != nil || b != input[i*1000+j] {
+						t.Fatalf("ReadByte() got = %v, err %v, want %v", b, err, input[i*1000+j])
+					}
+				}
+				if len(pb.buffer) == 0 || &pb.buffer[0] != &buffer[0] {
+					t.Fatalf("backing array replaced after reading %d bytes", (i+1)*1000)
+				}
+			}
+
+			pb.CompactBuffer()
+			pb.Peek(1000)
+			pb.Discard(1000)
+			if len(pb.buffer) >= 1000 {
+				t.Errorf("backing array of %d bytes kept after CompactBuffer", len(pb.buffer))
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_CompactBuffer(t *testing.T) {
+	input := benchmarkInput()[:100000]
+	pb := NewPeekBuffer(bytes.NewReader(input))
+	if _, err := pb.Peek(80000); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	if _, err := pb.Discard(70000); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+
+	pb.CompactBuffer()
+	if got := len(pb.buffer); got != pb.Buffered() {
+		t.Errorf("CompactBuffer() left a backing array of %d bytes, want %d", got, pb.Buffered())
+	}
+	got, err := io.ReadAll(pb)
+	if err != nil || !bytes.Equal(got, input[70000:]) {
+		t.Errorf("ReadAll() after CompactBuffer got %d bytes, err %v", len(got), err)
+	}
+
+	// Drained buffers are released
+	pb.CompactBuffer()
+	if pb.buffer != nil {
+		t.Errorf("CompactBuffer() kept a backing array of %d bytes for an empty buffer", len(pb.buffer))
+	}
+}
+
+func TestPeekBuffer_CompactBufferKeepsMark(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader(benchmarkInput()[:100000]))
+	if _, err := pb.Discard(10); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	pb.Mark()
+	if _, err := pb.Peek(50000); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	if _, err := pb.Discard(40000); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+
+	pb.CompactBuffer()
+	if err := pb.Rewind(); err != nil {
+		t.Fatalf("Rewind() error = %v", err)
+	}
+	got, err := io.ReadAll(pb)
+	if err != nil || !bytes.Equal(got, benchmarkInput()[10:100000]) {
+		t.Errorf("ReadAll() after Rewind got %d bytes, err %v", len(got), err)
+	}
+}
+
+func TestPeekBuffer_ByteAt(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	pb.Discard(1)
+	if _, err := pb.Peek(4); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	pb.reader = PanicReader{}
+	buffered := pb.Buffered()
+
+	tests := []struct {
+		i      int
+		want   byte
+		wantOk bool
+	}{
+		{0, 'e', true},
+		{3, 'o', true},
+		{buffered - 1, "hello world"[buffered], true},
+		{buffered, 0, false},
+		{-1, 0, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := pb.ByteAt(tt.i); got != tt.want || ok != tt.wantOk {
+			t.Errorf("ByteAt(%d) got = %q, %v, want %q, %v", tt.i, got, ok, tt.want, tt.wantOk)
+		}
+	}
+	if allocs := testing.AllocsPerRun(100, func() { pb.ByteAt(0) }); allocs != 0 {
+		t.Errorf("ByteAt() allocated %v times, want 0", allocs)
+	}
+}
+
+func TestPeekBuffer_PeekByteNegativeOffset(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello")))
+	if _, err := pb.PeekByte(-1); err != ErrNegativeOffset {
+		t.Errorf("PeekByte(-1) error = %v, want %v", err, ErrNegativeOffset)
+	}
+	if got := pb.Buffered(); got != 0 {
+		t.Errorf("PeekByte(-1) buffered %d bytes, want 0", got)
+	}
+}
+
+// FlakyReader is a mock reader that returns data, then an error once, then garbage
+type FlakyReader struct {
+	data  []byte
+	err   error
+	calls int
+}
+
+func (f *FlakyReader) Read(p []byte) (n int, err error) {
+	f.calls++
+	switch f.calls {
+	case 1:
+		return copy(p, f.data), nil
+	case 2:
+		return 0, f.err
+	default:
+		return copy(p, "garbage"), nil
+	}
+}
+
+func TestPeekBuffer_StickyError(t *testing.T) {
+	readErr := errors.New("read error")
+	reader := &FlakyReader{data: []byte("abc"), err: readErr}
+	pb := NewPeekBuffer(reader)
+
+	for i := 0; i < 2; i++ {
+		peeked, err := pb.Peek(10)
+		if err != readErr || string(peeked) != "abc" {
+			t.Errorf("Peek() got = %q, err %v, want %q, %v", string(peeked), err, "abc", readErr)
+		}
+	}
+
+	got, err := io.ReadAll(pb)
+	if err != readErr || string(got) != "abc" {
+		t.Errorf("ReadAll() got = %q, err %v, want %q, %v", string(got), err, "abc", readErr)
+	}
+	if _, err := pb.ReadByte(); err != readErr {
+		t.Errorf("ReadByte() error = %v, want %v", err, readErr)
+	}
+	if _, err := pb.Read(make([]byte, 5)); err != readErr {
+		t.Errorf("Read() error = %v, want %v", err, readErr)
+	}
+	if _, err := pb.Discard(5); err != readErr {
+		t.Errorf("Discard() error = %v, want %v", err, readErr)
+	}
+	if reader.calls != 2 {
+		t.Errorf("underlying reader was called %d times, want 2", reader.calls)
+	}
+
+	pb.Reset(bytes.NewReader([]byte("next")))
+	if got, err := io.ReadAll(pb); err != nil || string(got) != "next" {
+		t.Errorf("ReadAll() after Reset got = %q, err %v", string(got), err)
+	}
+}
+
+func TestPeekBuffer_PeekFull(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		size    int
+		want    string
+		wantErr error
+	}{
+		{"Exact", "hello world", 5, "hello", nil},
+		{"Whole stream", "hello", 5, "hello", nil},
+		{"Short stream", "hel", 5, "hel", io.ErrUnexpectedEOF},
+		{"Empty stream", "", 5, "", io.EOF},
+		{"Zero size", "", 0, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			got, err := pb.PeekFull(tt.size)
+			if err != tt.wantErr || string(got) != tt.want {
+				t.Errorf("PeekFull(%d) got = %q, err %v, want %q, %v", tt.size, string(got), err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Offset(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("hello world\nnext line")), 4)
+
+	steps := []struct {
+		name string
+		op   func() error
+		want int64
+	}{
+		{"Peek", func() error { _, err := pb.Peek(8); return err }, 0},
+		{"Read", func() error { _, err := pb.Read(make([]byte, 3)); return err }, 3},
+		{"ReadByte", func() error { _, err := pb.ReadByte(); return err }, 4},
+		{"Discard", func() error { _, err := pb.Discard(2); return err }, 6},
+		{"ReadSlice", func() error { _, err := pb.ReadSlice('\n'); return err }, 12},
+		{"Unread", func() error { return pb.Unread([]byte("\n")) }, 11},
+		{"ReadRune", func() error { _, _, err := pb.ReadRune(); return err }, 12},
+		{"Discard from reader", func() error { _, err := pb.Discard(5); return err }, 17},
+		{"Read from reader", func() error { _, err := io.ReadAll(pb); return err }, 21},
+	}
+
+	for _, step := range steps {
+		if err := step.op(); err != nil {
+			t.Fatalf("%s error = %v", step.name, err)
+		}
+		if got := pb.Offset(); got != step.want {
+			t.Errorf("Offset() after %s got = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestPeekBuffer_MarkRewind(t *testing.T) {
+	input := benchmarkInput()[:20000]
+
+	tests := []struct {
+		name string
+		peek int
+		skip int
+		read func(pb *PeekBuffer) error
+	}{
+		{"Read from buffer", 100, 10, func(pb *PeekBuffer) error {
+			_, err := io.ReadFull(pb, make([]byte, 50))
+			return err
+		}},
+		{"Read from reader", 0, 10, func(pb *PeekBuffer) error {
+			_, err := io.ReadFull(pb, make([]byte, 15000))
+			return err
+		}},
+		{"ReadByte", 0, 10, func(pb *PeekBuffer) error {
+			for i := 0; i < 9000; i++ {
+				if _, err := pb.ReadByte(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"Discard", 0, 10, func(pb *PeekBuffer) error {
+			_, err := pb.Discard(12000)
+			return err
+		}},
+		{"Peek and read", 0, 10, func(pb *PeekBuffer) error {
+			if _, err := pb.Peek(10000); err != nil {
+				return err
+			}
+			_, err := pb.Discard(9000)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+			if _, err := pb.Discard(tt.skip); err != nil {
+				t.Fatalf("Discard() error = %v", err)
+			}
+
+			pb.Mark()
+			if err := tt.read(pb); err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if err := pb.Rewind(); err != nil {
+				t.Fatalf("Rewind() error = %v", err)
+			}
+			if got := pb.Offset(); got != int64(tt.skip) {
+				t.Errorf("Offset() after Rewind got = %v, want %v", got, tt.skip)
+			}
+
+			got, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(got, input[tt.skip:]) {
+				t.Errorf("ReadAll() after Rewind got %d bytes, err %v, want %d bytes", len(got), err, len(input)-tt.skip)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_MarkTwice(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("hello world")), 2)
+	pb.Mark()
+	pb.Discard(3)
+	pb.Mark()
+	pb.Discard(4)
+	if err := pb.Unread([]byte("LO")); err != nil {
+		t.Fatalf("Unread() error = %v", err)
+	}
+	if err := pb.Rewind(); err != nil {
+		t.Fatalf("Rewind() error = %v", err)
+	}
+
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "loLOorld" {
+		t.Errorf("ReadAll() after Rewind got = %q, err %v, want %q", string(got), err, "loLOorld")
+	}
+}
+
+func TestPeekBuffer_MarkUnread(t *testing.T) {
+	const input = "abcdefgh"
+
+	tests := []struct {
+		name   string
+		skip   int
+		read   int
+		unread string
+		offset int64
+		want   string
+	}{
+		{"Unread read bytes", 0, 4, "cd", 0, "abcdefgh"},
+		{"Unread replaced bytes", 0, 4, "CD", 0, "abCDefgh"},
+		{"Unread at mark", 4, 0, "xy", 2, "xyefgh"},
+		{"Unread before mark", 3, 1, "cd", 2, "cdefgh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), 2)
+			pb.Discard(tt.skip)
+			pb.Mark()
+			pb.Discard(tt.read)
+			if err := pb.Unread([]byte(tt.unread)); err != nil {
+				t.Fatalf("Unread() error = %v", err)
+			}
+			if err := pb.Rewind(); err != nil {
+				t.Fatalf("Rewind() error = %v", err)
+			}
+			if got := pb.Offset(); got != tt.offset {
+				t.Errorf("Offset() after Rewind got = %d, want %d", got, tt.offset)
+			}
+			got, err := io.ReadAll(pb)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() after Rewind got = %q, err %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_RewindWithoutMark(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello")))
+	if err := pb.Rewind(); err != ErrNoMark {
+		t.Errorf("Rewind() error = %v, want %v", err, ErrNoMark)
+	}
+
+	pb.Mark()
+	if err := pb.Rewind(); err != nil {
+		t.Errorf("Rewind() error = %v, want nil", err)
+	}
+	if err := pb.Rewind(); err != ErrNoMark {
+		t.Errorf("second Rewind() error = %v, want %v", err, ErrNoMark)
+	}
+}
+
+func TestPeekBuffer_PeekAt(t *testing.T) {
+	const input = "hello world"
+
+	tests := []struct {
+		name    string
+		offset  int
+		size    int
+		want    string
+		wantErr error
+	}{
+		{"Start", 0, 5, "hello", nil},
+		{"Middle", 6, 3, "wor", nil},
+		{"End", 6, 5, "world", nil},
+		{"Past end", 6, 10, "world", io.EOF},
+		{"After end", 20, 5, "", io.EOF},
+		{"Empty window", 3, 0, "", nil},
+		{"Negative offset", -1, 5, "", ErrNegativeOffset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), 2)
+			got, err := pb.PeekAt(tt.offset, tt.size)
+			if err != tt.wantErr || string(got) != tt.want {
+				t.Errorf("PeekAt(%d, %d) got = %q, err %v, want %q, %v", tt.offset, tt.size, string(got), err, tt.want, tt.wantErr)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != input {
+				t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekLimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		buffered int
+		size     int
+		maxFill  int
+		maxSize  int
+		want     string
+		wantErr  error
+	}{
+		{"Within limit", "hello world", 0, 5, 8, 0, "hello", nil},
+		{"Limit reached", "hello world", 0, 10, 4, 0, "hell", ErrFillLimit},
+		{"Limit equals size", "hello world", 0, 5, 5, 0, "hello", nil},
+		{"Buffered data is free", "hello world", 8, 10, 2, 0, "hello worl", nil},
+		{"Buffered data then limit", "hello world", 3, 10, 2, 0, "hello", ErrFillLimit},
+		{"Zero limit", "hello world", 0, 5, 0, 0, "", ErrFillLimit},
+		{"Short stream", "hi", 0, 5, 8, 0, "hi", nil},
+		{"Buffer full", "hello world", 0, 10, 8, 6, "hello ", ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reads := 0
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), 3)
+			if _, err := pb.PeekFull(tt.buffered); err != nil && tt.buffered > 0 {
+				t.Fatalf("PeekFull() error = %v", err)
+			}
+			pb.SetMaxBuffer(tt.maxSize)
+			pb.SetOnFill(func(n int, err error) {
+				reads += n
+			})
+
+			got, err := pb.PeekLimited(tt.size, tt.maxFill)
+			if string(got) != tt.want || err != tt.wantErr {
+				t.Errorf("PeekLimited() got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+			if reads > tt.maxFill {
+				t.Errorf("PeekLimited() read %d bytes, limit %d", reads, tt.maxFill)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekString(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		size    int
+		maxSize int
+		want    string
+		wantErr error
+	}{
+		{"Prefix", "hello world", 5, 0, "hello", nil},
+		{"Whole stream", "hello", 5, 0, "hello", nil},
+		{"Short stream", "hi", 5, 0, "hi", nil},
+		{"Empty", "", 5, 0, "", nil},
+		{"Buffer full", "hello world", 8, 4, "hell", ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			pb.SetMaxBuffer(tt.maxSize)
+			got, err := pb.PeekString(tt.size)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("PeekString() got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+
+			// The string is a copy, so overwriting the buffer must not change it
+			peeked, _ := pb.Peek(tt.size)
+			for i := range peeked {
+				peeked[i] = 'x'
+			}
+			if got != tt.want {
+				t.Errorf("PeekString() result changed to %q after the buffer was modified", got)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekMatch(t *testing.T) {
+	patterns := [][]byte{[]byte("GET "), []byte("POST "), []byte("PRI * HTTP/2.0"), []byte("\x16\x03")}
+
+	tests := []struct {
+		name    string
+		input   string
+		maxSize int
+		want    int
+		wantErr error
+	}{
+		{"First", "GET / HTTP/1.1\r\n", 0, 0, nil},
+		{"Second", "POST / HTTP/1.1\r\n", 0, 1, nil},
+		{"Longest", "PRI * HTTP/2.0\r\n", 0, 2, nil},
+		{"Short pattern in short stream", "\x16\x03\x01", 0, 3, nil},
+		{"No match", "PUT / HTTP/1.1\r\n", 0, -1, nil},
+		{"Stream shorter than pattern", "PRI *", 0, -1, nil},
+		{"Empty", "", 0, -1, nil},
+		{"Decided within the maximum buffer size", "GET / HTTP/1.1\r\n", 6, 0, nil},
+		{"Undecided within the maximum buffer size", "PRI * HTTP/2.0\r\n", 6, -1, ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			pb.SetMaxBuffer(tt.maxSize)
+			got, err := pb.PeekMatch(patterns)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("PeekMatch() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_AppendPeek(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	scratch := make([]byte, 0, 16)
+
+	got, err := pb.AppendPeek(scratch, 5)
+	if err != nil || string(got) != "hello" || &got[0] != &scratch[:1][0] {
+		t.Errorf("AppendPeek() got = %q, err %v, want %q in the scratch buffer", got, err, "hello")
+	}
+	got, err = pb.AppendPeek([]byte("> "), 20)
+	if err != nil || string(got) != "> hello world" {
+		t.Errorf("AppendPeek() got = %q, err %v, want %q", got, err, "> hello world")
+	}
+
+	// The result is a copy, so reads do not affect it
+	got, _ = pb.AppendPeek(scratch[:0], 5)
+	pb.Read(make([]byte, 11))
+	pb.Reset(bytes.NewReader([]byte("jello")))
+	pb.Peek(5)
+	if string(got) != "hello" {
+		t.Errorf("AppendPeek() result changed to %q after reading", got)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		pb.AppendPeek(scratch[:0], 5)
+	})
+	if allocs != 0 {
+		t.Errorf("AppendPeek() allocated %v times per call, want 0", allocs)
+	}
+}
+
+func TestPeekBuffer_PeekExact(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		size    int
+		dst     int
+		want    string
+		wantErr error
+	}{
+		{"Exact", strings.NewReader("hello world"), 5, 8, "hello", nil},
+		{"Whole stream", strings.NewReader("hello"), 5, 5, "hello", nil},
+		{"Short", strings.NewReader("hel"), 5, 5, "hel", io.ErrUnexpectedEOF},
+		{"Empty", strings.NewReader(""), 5, 5, "", io.EOF},
+		{"Short buffer", strings.NewReader("hello"), 5, 4, "", io.ErrShortBuffer},
+		{"Read error", io.MultiReader(strings.NewReader("he"), &ErrorReader{err: readErr}), 5, 5, "he", readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader)
+			dst := make([]byte, tt.dst)
+			n, err := pb.PeekExact(tt.size, dst)
+			if err != tt.wantErr || string(dst[:n]) != tt.want {
+				t.Errorf("PeekExact() got = %q, err %v, want %q, err %v", dst[:n], err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != 0 {
+				t.Errorf("PeekExact() consumed %d bytes", pb.Offset())
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Available(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		n       int
+		maxSize int
+		want    bool
+		wantErr error
+	}{
+		{"Available", strings.NewReader("hello world"), 5, 0, true, nil},
+		{"Exactly available", strings.NewReader("hello"), 5, 0, true, nil},
+		{"Stream ends", strings.NewReader("hi"), 5, 0, false, nil},
+		{"Empty", strings.NewReader(""), 1, 0, false, nil},
+		{"Zero", strings.NewReader(""), 0, 0, true, nil},
+		{"Buffer full", strings.NewReader("hello world"), 8, 4, false, ErrBufferFull},
+		{"Read error", io.MultiReader(strings.NewReader("hi"), &ErrorReader{err: readErr}), 5, 0, false, readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader)
+			pb.SetMaxBuffer(tt.maxSize)
+			got, err := pb.Available(tt.n)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("Available() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != 0 {
+				t.Errorf("Available() consumed %d bytes", pb.Offset())
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_EOF(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		want    bool
+		wantErr error
+	}{
+		{"Data", strings.NewReader("hello"), false, nil},
+		{"Empty", strings.NewReader(""), true, nil},
+		{"Data with EOF", iotest.DataErrReader(strings.NewReader("h")), false, nil},
+		{"Data with error", &DataErrorReader{data: []byte("h"), err: readErr}, false, nil},
+		{"Read error", &ErrorReader{err: readErr}, false, readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(tt.reader)
+			got, err := pb.EOF()
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("EOF() got = %v, err %v, want %v, err %v", got, err, tt.want, tt.wantErr)
+			}
+			if pb.Offset() != 0 {
+				t.Errorf("EOF() consumed %d bytes", pb.Offset())
+			}
+		})
+	}
+
+	// Buffered data is checked without reading, and the probed byte is not consumed
+	pb := NewPeekBuffer(strings.NewReader("hi"))
+	pb.Peek(1)
+	pb.reader = PanicReader{}
+	if got, err := pb.EOF(); got || err != nil {
+		t.Errorf("EOF() with buffered data got = %v, err %v, want false", got, err)
+	}
+	pb = NewPeekBuffer(strings.NewReader("hi"))
+	pb.Discard(2)
+	if got, err := pb.EOF(); !got || err != nil {
+		t.Errorf("EOF() at the end got = %v, err %v, want true", got, err)
+	}
+}
+
+func TestPeekBuffer_HasPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		prefix string
+		want   bool
+	}{
+		{"Match", "hello world", "hello", true},
+		{"Whole stream", "hello", "hello", true},
+		{"Empty prefix", "hello", "", true},
+		{"Mismatch", "hello world", "help", false},
+		{"Stream shorter than prefix", "hel", "hello", false},
+		{"Empty stream", "", "hello", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			got, err := pb.HasPrefix([]byte(tt.prefix))
+			if err != nil || got != tt.want {
+				t.Errorf("HasPrefix(%q) got = %v, err %v, want %v", tt.prefix, got, err, tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Expect(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		prefix    string
+		want      bool
+		remaining string
+	}{
+		{"Match", "hello world", "hello", true, " world"},
+		{"Whole stream", "hello", "hello", true, ""},
+		{"Mismatch", "hello world", "help", false, "hello world"},
+		{"Stream shorter than prefix", "hel", "hello", false, "hel"},
+		{"Empty stream", "", "hello", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), 2)
+			got, err := pb.Expect([]byte(tt.prefix))
+			if err != nil || got != tt.want {
+				t.Errorf("Expect(%q) got = %v, err %v, want %v", tt.prefix, got, err, tt.want)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.remaining {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.remaining)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_Tee(t *testing.T) {
+	input := benchmarkInput()[:20000]
+	pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+	var tee bytes.Buffer
+	pb.SetTee(&tee)
+
+	steps := []func() error{
+		func() error { _, err := pb.Peek(1500); return err },
+		func() error { _, err := io.ReadFull(pb, make([]byte, 700)); return err },
+		func() error { _, err := pb.ReadByte(); return err },
+		func() error { _, err := pb.Peek(3000); return err },
+		func() error { _, err := pb.Discard(5000); return err },
+		func() error { _, err := pb.ReadSlice(0); return err },
+		func() error { _, err := pb.PeekAll(); return err },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d error = %v", i, err)
+		}
+		if !bytes.Equal(tee.Bytes(), input[:pb.Offset()]) {
+			t.Fatalf("after step %d tee got %d bytes, want the %d consumed bytes", i, tee.Len(), pb.Offset())
+		}
+	}
+
+	if _, err := io.ReadAll(pb); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(tee.Bytes(), input) {
+		t.Errorf("tee got %d bytes, want %d", tee.Len(), len(input))
+	}
+}
+
+func TestPeekBuffer_TeeDirectRead(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	var tee bytes.Buffer
+	pb.SetTee(&tee)
+
+	if _, err := io.ReadFull(pb, make([]byte, 3)); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if _, err := pb.Discard(3); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if tee.String() != "hello " {
+		t.Errorf("tee got = %q, want %q", tee.String(), "hello ")
+	}
+}
+
+func TestPeekBuffer_Capture(t *testing.T) {
+	input := "hello world, hello again"
+
+	tests := []struct {
+		name  string
+		limit int
+		read  func(pb *PeekBuffer)
+		want  string
+	}{
+		{"Peek then read", 100, func(pb *PeekBuffer) {
+			pb.Peek(8)
+			io.ReadFull(pb, make([]byte, 5))
+			pb.ReadByte()
+		}, "hello "},
+		{"Limit", 8, func(pb *PeekBuffer) {
+			io.ReadAll(pb)
+		}, "hello wo"},
+		{"Unread", 100, func(pb *PeekBuffer) {
+			io.ReadFull(pb, make([]byte, 5))
+			pb.Unread([]byte("hello"))
+			io.ReadFull(pb, make([]byte, 7))
+		}, "hello w"},
+		{"Rewind", 100, func(pb *PeekBuffer) {
+			pb.Mark()
+			pb.Discard(5)
+			pb.Rewind()
+			pb.Discard(7)
+		}, "hello w"},
+		{"Direct reads", 100, func(pb *PeekBuffer) {
+			io.ReadFull(pb, make([]byte, 3))
+			pb.Discard(3)
+		}, "hello "},
+		{"Disabled", 0, func(pb *PeekBuffer) {
+			io.ReadAll(pb)
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(strings.NewReader(input), 4)
+			var capture bytes.Buffer
+			pb.SetCapture(&capture, tt.limit)
+			tt.read(pb)
+			if got := capture.String(); got != tt.want {
+				t.Errorf("capture got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// FailingWriter is a mock writer that always returns an error
+type FailingWriter struct {
+	calls int
+}
+
+func (f *FailingWriter) Write(p []byte) (int, error) {
+	f.calls++
+	return 0, errors.New("write failed")
+}
+
+func TestPeekBuffer_CaptureWriteError(t *testing.T) {
+	pb := NewPeekBufferSize(strings.NewReader("hello world"), 4)
+	w := &FailingWriter{}
+	pb.SetCapture(w, 100)
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() with failing capture got = %q, err %v", got, err)
+	}
+	if w.calls != 1 {
+		t.Errorf("capture written %d times after a failed write, want 1", w.calls)
+	}
+}
+
+func TestPeekBuffer_Fill(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		min     int
+		maxSize int
+		want    int
+		wantErr error
+	}{
+		{"Fill", "hello world", 5, 0, 5, nil},
+		{"Fill whole stream", "hello world", 11, 0, 11, nil},
+		{"Fill past end", "hello", 11, 0, 5, nil},
+		{"Fill past max", "hello world", 11, 8, 8, ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), 1)
+			pb.SetMaxBuffer(tt.maxSize)
+			if err := pb.Fill(tt.min); err != tt.wantErr {
+				t.Errorf("Fill(%d) error = %v, wantErr %v", tt.min, err, tt.wantErr)
+			}
+			if got := pb.Buffered(); got != tt.want {
+				t.Errorf("Buffered() after Fill(%d) got = %v, want %v", tt.min, got, tt.want)
+			}
+		})
+	}
+}
+
+func unreadByteScanner(scanner io.ByteScanner) (byte, error) {
+	b, err := scanner.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return b, scanner.UnreadByte()
+}
+
+func TestPeekBuffer_UnreadByte(t *testing.T) {
+	for _, fillSize := range []int{1, FillPeekBufferSize} {
+		t.Run(fmt.Sprintf("Fill size %d", fillSize), func(t *testing.T) {
+			testUnreadByte(t, NewPeekBufferSize(bytes.NewReader([]byte("abc")), fillSize))
+		})
+	}
+}
+
+func testUnreadByte(t *testing.T, pb *PeekBuffer) {
+	for _, want := range []byte("abc") {
+		b, err := unreadByteScanner(pb)
+		if err != nil || b != want {
+			t.Fatalf("ReadByte() got = %q, err %v, want %q", b, err, want)
+		}
+		if got := pb.Offset(); got != int64(want-'a') {
+			t.Errorf("Offset() after UnreadByte got = %v, want %v", got, want-'a')
+		}
+		if b, err = pb.ReadByte(); err != nil || b != want {
+			t.Fatalf("ReadByte() after UnreadByte got = %q, err %v, want %q", b, err, want)
+		}
+	}
+	if _, err := unreadByteScanner(pb); err != io.EOF {
+		t.Errorf("ReadByte() at end error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestPeekBuffer_UnreadByteInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(pb *PeekBuffer)
+	}{
+		{"No ReadByte", func(pb *PeekBuffer) {}},
+		{"After Read", func(pb *PeekBuffer) { pb.ReadByte(); pb.Read(make([]byte, 1)) }},
+		{"After Discard", func(pb *PeekBuffer) { pb.ReadByte(); pb.Discard(1) }},
+		{"After Unread", func(pb *PeekBuffer) { pb.ReadByte(); pb.Unread([]byte("x")) }},
+		{"After UnreadByte", func(pb *PeekBuffer) { pb.ReadByte(); pb.UnreadByte() }},
+		{"After failed ReadByte", func(pb *PeekBuffer) { pb.Discard(4); pb.ReadByte(); pb.ReadByte() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte("hello")))
+			tt.op(pb)
+			if err := pb.UnreadByte(); err != ErrInvalidUnreadByte {
+				t.Errorf("UnreadByte() error = %v, want %v", err, ErrInvalidUnreadByte)
+			}
+		})
+	}
+
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello")))
+	pb.ReadByte()
+	pb.Peek(3)
+	if err := pb.UnreadByte(); err != nil {
+		t.Errorf("UnreadByte() after Peek error = %v, want nil", err)
+	}
+}
+
+func TestPeekBuffer_UnreadRune(t *testing.T) {
+	input := "aé€\xff"
+	pb := NewPeekBufferSize(strings.NewReader(input), 1)
+
+	for _, want := range []rune{'a', 'é', '€', utf8.RuneError} {
+		offset := pb.Offset()
+		r, size, err := pb.ReadRune()
+		if err != nil || r != want {
+			t.Fatalf("ReadRune() got = %q, err %v, want %q", r, err, want)
+		}
+		if err := pb.UnreadRune(); err != nil {
+			t.Fatalf("UnreadRune() error = %v", err)
+		}
+		if pb.Offset() != offset {
+			t.Errorf("Offset() after UnreadRune got = %v, want %v", pb.Offset(), offset)
+		}
+		if r, got, err := pb.ReadRune(); err != nil || r != want || got != size {
+			t.Fatalf("ReadRune() after UnreadRune got = %q, %v, err %v, want %q, %v", r, got, err, want, size)
+		}
+	}
+	if got, err := io.ReadAll(pb); err != nil || len(got) != 0 {
+		t.Errorf("ReadAll() at end got = %q, err %v", got, err)
+	}
+}
+
+func TestPeekBuffer_UnreadRuneInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(pb *PeekBuffer)
+	}{
+		{"No ReadRune", func(pb *PeekBuffer) {}},
+		{"After ReadByte", func(pb *PeekBuffer) { pb.ReadByte() }},
+		{"After Read", func(pb *PeekBuffer) { pb.ReadRune(); pb.Read(make([]byte, 1)) }},
+		{"After UnreadRune", func(pb *PeekBuffer) { pb.ReadRune(); pb.UnreadRune() }},
+		{"After failed ReadRune", func(pb *PeekBuffer) { pb.Discard(6); pb.ReadRune() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(strings.NewReader("héllo"))
+			tt.op(pb)
+			if err := pb.UnreadRune(); err != ErrInvalidUnreadRune {
+				t.Errorf("UnreadRune() error = %v, want %v", err, ErrInvalidUnreadRune)
+			}
+		})
+	}
+
+	pb := NewPeekBuffer(strings.NewReader("héllo"))
+	pb.ReadRune()
+	if err := pb.UnreadByte(); err != ErrInvalidUnreadByte {
+		t.Errorf("UnreadByte() after ReadRune error = %v, want %v", err, ErrInvalidUnreadByte)
+	}
+}
+
+// bufioReader is the method set of *bufio.Reader.
+type bufioReader interface {
+	Buffered() int
+	Discard(n int) (discarded int, err error)
+	Peek(n int) ([]byte, error)
+	Read(p []byte) (n int, err error)
+	ReadByte() (byte, error)
+	ReadBytes(delim byte) ([]byte, error)
+	ReadLine() (line []byte, isPrefix bool, err error)
+	ReadRune() (r rune, size int, err error)
+	ReadSlice(delim byte) (line []byte, err error)
+	ReadString(delim byte) (string, error)
+	Reset(r io.Reader)
+	Size() int
+	UnreadByte() error
+	UnreadRune() error
+	WriteTo(w io.Writer) (n int64, err error)
+}
+
+var _ bufioReader = (*bufio.Reader)(nil)
+var _ bufioReader = (*PeekBuffer)(nil)
+
+func TestPeekBuffer_BufioCompatible(t *testing.T) {
+	input := "first line\nsecond line\nthird"
+
+	for _, name := range []string{"bufio.Reader", "PeekBuffer"} {
+		t.Run(name, func(t *testing.T) {
+			var r bufioReader
+			if name == "bufio.Reader" {
+				r = bufio.NewReaderSize(strings.NewReader(input), 16)
+			} else {
+				r = NewPeekBufferSize(strings.NewReader(input), 16)
+			}
+
+			if peeked, err := r.Peek(5); err != nil || string(peeked) != "first" {
+				t.Errorf("Peek() got = %q, err %v", peeked, err)
+			}
+			if line, isPrefix, err := r.ReadLine(); err != nil || isPrefix || string(line) != "first line" {
+				t.Errorf("ReadLine() got = %q, %v, err %v", line, isPrefix, err)
+			}
+			if b, err := r.ReadByte(); err != nil || b != 's' || r.UnreadByte() != nil {
+				t.Errorf("ReadByte() got = %q, err %v", b, err)
+			}
+			if s, err := r.ReadString(' '); err != nil || s != "second " {
+				t.Errorf("ReadString() got = %q, err %v", s, err)
+			}
+			if n, err := r.Discard(4); err != nil || n != 4 {
+				t.Errorf("Discard() got = %v, err %v", n, err)
+			}
+			if n, err := r.Discard(-1); err != bufio.ErrNegativeCount || n != 0 {
+				t.Errorf("Discard(-1) got = %v, err %v, want 0, %v", n, err, bufio.ErrNegativeCount)
+			}
+			if rn, _, err := r.ReadRune(); err != nil || rn != '\n' || r.UnreadRune() != nil {
+				t.Errorf("ReadRune() got = %q, err %v", rn, err)
+			}
+			if r.Size() != 16 || r.Buffered() == 0 {
+				t.Errorf("Size() got = %v, Buffered() got = %v", r.Size(), r.Buffered())
+			}
+			var out bytes.Buffer
+			if n, err := r.WriteTo(&out); err != nil || out.String() != "\nthird" || n != 6 {
+				t.Errorf("WriteTo() got = %q, %v, err %v", out.String(), n, err)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_WriteTo(t *testing.T) {
+	input := benchmarkInput()[:20000]
+	pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+	pb.Peek(1500)
+	pb.Discard(10)
+
+	var out bytes.Buffer
+	n, err := io.Copy(&out, pb)
+	if err != nil || n != int64(len(input)-10) || !bytes.Equal(out.Bytes(), input[10:]) {
+		t.Errorf("io.Copy() got %d bytes, err %v, want %d", n, err, len(input)-10)
+	}
+	if n, err := pb.WriteTo(&out); n != 0 || err != nil {
+		t.Errorf("WriteTo() at end got = %v, err %v, want 0, nil", n, err)
+	}
+
+	readErr := errors.New("read failed")
+	pb = NewPeekBuffer(io.MultiReader(strings.NewReader("hello"), &ErrorReader{err: readErr}))
+	out.Reset()
+	if n, err := pb.WriteTo(&out); n != 5 || err != readErr || out.String() != "hello" {
+		t.Errorf("WriteTo() got = %q, %v, err %v, want %q, 5, %v", out.String(), n, err, "hello", readErr)
+	}
+}
+
+func TestPeekBuffer_NextToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		split   bufio.SplitFunc
+		maxSize int
+		want    []string
+		wantErr error
+	}{
+		{"Lines", "one\r\ntwo\n\nthree", bufio.ScanLines, 0, []string{"one", "two", "", "three"}, io.EOF},
+		{"Words", "  one two\tthree  ", bufio.ScanWords, 0, []string{"one", "two", "three"}, io.EOF},
+		{"Runes", "aé€", bufio.ScanRunes, 0, []string{"a", "é", "€"}, io.EOF},
+		{"Empty", "", bufio.ScanLines, 0, nil, io.EOF},
+		{"Too long", "one\ntwo three four\n", bufio.ScanLines, 8, []string{"one"}, ErrBufferFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(tt.input)), 2)
+			pb.SetMaxBuffer(tt.maxSize)
+
+			var got []string
+			for {
+				token, err := pb.NextToken(tt.split)
+				if err != nil {
+					if err != tt.wantErr {
+						t.Errorf("NextToken() error = %v, wantErr %v", err, tt.wantErr)
+					}
+					break
+				}
+				got = append(got, string(token))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("NextToken() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_NextTokenSplitError(t *testing.T) {
+	splitErr := errors.New("split error")
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+
+	token, err := pb.NextToken(func(data []byte, atEOF bool) (int, []byte, error) {
+		return 2, data[:2], splitErr
+	})
+	if err != splitErr || string(token) != "he" {
+		t.Errorf("NextToken() got = %q, err %v, want %q, %v", string(token), err, "he", splitErr)
+	}
+
+	token, err = pb.NextToken(func(data []byte, atEOF bool) (int, []byte, error) {
+		return len(data) + 1, nil, nil
+	})
+	if err != bufio.ErrAdvanceTooFar {
+		t.Errorf("NextToken() error = %v, want %v", err, bufio.ErrAdvanceTooFar)
+	}
+
+	remaining, err := io.ReadAll(pb)
+	if err != nil || string(remaining) != "llo world" {
+		t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+	}
+}
+
+func TestPeekBuffer_ReadBytes(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("one\ntwo three four\nfive")), 2)
+	pb.SetMaxBuffer(4)
+
+	var lines [][]byte
+	for _, want := range []struct {
+		line string
+		err  error
+	}{
+		{"one\n", nil},
+		{"two three four\n", nil},
+		{"five", io.EOF},
+	} {
+		line, err := pb.ReadBytes('\n')
+		if err != want.err || string(line) != want.line {
+			t.Errorf("ReadBytes() got = %q, err %v, want %q, %v", string(line), err, want.line, want.err)
+		}
+		lines = append(lines, line)
+	}
+
+	// Earlier results must not be overwritten by later reads.
+	if got := string(bytes.Join(lines, nil)); got != "one\ntwo three four\nfive" {
+		t.Errorf("ReadBytes() results got = %q after later reads", got)
+	}
+}
@@ -0,0 +1,133 @@
+// Package peektest provides readers that model the io.Reader edge cases a PeekBuffer must handle,
+// for testing code that is built on top of one.
+package peektest
+
+import (
+	"io"
+)
+
+// ErrorReader returns a reader that returns err from every call to Read without returning any data.
+//
+// Parameters:
+//   - err error: The error to return.
+//
+// Returns:
+//   - io.Reader: A reader that always fails.
+func ErrorReader(err error) io.Reader {
+	return &errorReader{err: err}
+}
+
+type errorReader struct {
+	err error
+}
+
+func (this *errorReader) Read(p []byte) (int, error) {
+	return 0, this.err
+}
+
+// ErrorAfter returns a reader that reads from r until n bytes have been returned, then returns err
+// from every later call to Read, like a connection that is reset part way through a stream.
+// If r ends before n bytes, its io.EOF is returned as usual.
+//
+// Parameters:
+//   - r io.Reader: The reader to read data from.
+//   - n int64: The number of bytes to return before failing.
+//   - err error: The error to return once n bytes have been read.
+//
+// Returns:
+//   - io.Reader: A reader that fails after n bytes.
+func ErrorAfter(r io.Reader, n int64, err error) io.Reader {
+	return &errorAfterReader{reader: r, remaining: n, err: err}
+}
+
+type errorAfterReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (this *errorAfterReader) Read(p []byte) (int, error) {
+	if this.remaining <= 0 {
+		return 0, this.err
+	}
+	if int64(len(p)) > this.remaining {
+		p = p[:this.remaining]
+	}
+	n, err := this.reader.Read(p)
+	this.remaining -= int64(n)
+	return n, err
+}
+
+// ShortReader returns a reader that returns at most size bytes from each call to Read, however large the
+// buffer passed to it, like a network connection delivering small packets. It generalizes iotest.OneByteReader.
+//
+// Parameters:
+//   - r io.Reader: The reader to read data from.
+//   - size int: The maximum number of bytes to return from each call to Read. Must be at least 1.
+//
+// Returns:
+//   - io.Reader: A reader that returns short reads.
+//
+// Panics if size is less than 1.
+func ShortReader(r io.Reader, size int) io.Reader {
+	if size < 1 {
+		panic("peektest: size must be at least 1")
+	}
+	return &shortReader{reader: r, size: size}
+}
+
+type shortReader struct {
+	reader io.Reader
+	size   int
+}
+
+func (this *shortReader) Read(p []byte) (int, error) {
+	if len(p) > this.size {
+		p = p[:this.size]
+	}
+	return this.reader.Read(p)
+}
+
+// DataErrorReader returns a reader that returns err together with the last bytes of r, in the same call to Read,
+// rather than from a separate call once the data is exhausted. io.Reader allows n > 0 with a non-nil error, and
+// callers must process the data before handling the error. Unlike iotest.DataErrReader the error need not be io.EOF.
+// Every call to Read after the data is exhausted returns err again.
+//
+// Parameters:
+//   - r io.Reader: The reader to read data from.
+//   - err error: The error to return with the last bytes of r.
+//
+// Returns:
+//   - io.Reader: A reader that returns its final data together with err.
+func DataErrorReader(r io.Reader, err error) io.Reader {
+	return &dataErrorReader{reader: r, err: err, unread: make([]byte, 1024)}
+}
+
+type dataErrorReader struct {
+	reader io.Reader
+	err    error
+	unread []byte // scratch space for reading ahead
+	data   []byte // data read ahead but not yet returned
+	eof    bool   // whether r has returned io.EOF
+}
+
+func (this *dataErrorReader) Read(p []byte) (int, error) {
+	// Read ahead until r ends or there is more data than p can hold, so the last bytes can be returned with err
+	for !this.eof && len(this.data) <= len(p) {
+		n, err := this.reader.Read(this.unread)
+		this.data = append(this.data, this.unread[:n]...)
+		if err == io.EOF {
+			this.eof = true
+		} else if err != nil {
+			n = copy(p, this.data)
+			this.data = this.data[n:]
+			return n, err
+		}
+	}
+	n := copy(p, this.data)
+	this.data = this.data[n:]
+	if this.eof && len(this.data) == 0 {
+		return n, this.err
+	}
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package peektest
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/claytonsingh/golib/peekbuffer"
+)
+
+type readResult struct {
+	data string
+	err  error
+}
+
+// readAll records the result of every call to Read until an error is returned.
+func readAll(r io.Reader, size int) []readResult {
+	var results []readResult
+	p := make([]byte, size)
+	for i := 0; i < 10; i++ {
+		n, err := r.Read(p)
+		results = append(results, readResult{string(p[:n]), err})
+		if err != nil {
+			break
+		}
+	}
+	return results
+}
+
+func TestReaders(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name   string
+		reader io.Reader
+		size   int
+		want   []readResult
+	}{
+		{"ErrorReader", ErrorReader(readErr), 4, []readResult{{"", readErr}}},
+		{"ErrorAfter", ErrorAfter(strings.NewReader("hello world"), 6, readErr), 4, []readResult{{"hell", nil}, {"o ", nil}, {"", readErr}}},
+		{"ErrorAfter short stream", ErrorAfter(strings.NewReader("hi"), 6, readErr), 4, []readResult{{"hi", nil}, {"", io.EOF}}},
+		{"ShortReader", ShortReader(strings.NewReader("hello"), 2), 4, []readResult{{"he", nil}, {"ll", nil}, {"o", nil}, {"", io.EOF}}},
+		{"DataErrorReader", DataErrorReader(strings.NewReader("hello"), readErr), 4, []readResult{{"hell", nil}, {"o", readErr}}},
+		{"DataErrorReader in one read", DataErrorReader(strings.NewReader("hello"), readErr), 8, []readResult{{"hello", readErr}}},
+		{"DataErrorReader EOF", DataErrorReader(strings.NewReader("hello"), io.EOF), 8, []readResult{{"hello", io.EOF}}},
+		{"DataErrorReader empty", DataErrorReader(strings.NewReader(""), readErr), 8, []readResult{{"", readErr}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAll(tt.reader, tt.size)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Read() got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Read() call %d got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestShortReader_Invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("ShortReader(r, 0) did not panic")
+		}
+	}()
+	ShortReader(strings.NewReader("hello"), 0)
+}
+
+func TestReaders_PeekBuffer(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		want    string
+		wantErr error
+	}{
+		{"ErrorAfter", ErrorAfter(strings.NewReader("hello world"), 6, readErr), "hello ", readErr},
+		{"ShortReader", ShortReader(strings.NewReader("hello world"), 3), "hello world", nil},
+		{"DataErrorReader", DataErrorReader(strings.NewReader("hello world"), readErr), "hello world", readErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := peekbuffer.NewPeekBufferSize(tt.reader, 4)
+			if peeked, err := pb.Peek(5); err != nil || string(peeked) != "hello" {
+				t.Errorf("Peek() got = %q, err %v, want %q", peeked, err, "hello")
+			}
+			got, err := io.ReadAll(pb)
+			if err != tt.wantErr || string(got) != tt.want {
+				t.Errorf("ReadAll() got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
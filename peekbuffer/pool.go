@@ -0,0 +1,59 @@
+package peekbuffer
+
+import (
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the largest backing array kept by PutPeekBuffer. Larger arrays are dropped
+// so that one very large peek does not pin its memory in the pool indefinitely.
+const maxPooledBufferSize = 64 << 10
+
+var peekBufferPool = sync.Pool{
+	New: func() any {
+		return NewPeekBuffer(nil)
+	},
+}
+
+// GetPeekBuffer returns a PeekBuffer from a package-level pool that wraps reader, allocating one if the pool is empty.
+// The PeekBuffer is configured like one returned by NewPeekBuffer, but reuses the backing array of a previously
+// pooled PeekBuffer, which avoids allocating a buffer for every stream on busy servers.
+// Return it with PutPeekBuffer once the stream has been handled.
+//
+// Parameters:
+//   - reader io.Reader: The underlying reader to wrap.
+//
+// Returns:
+//   - *PeekBuffer: A PeekBuffer reading from reader.
+func GetPeekBuffer(reader io.Reader) *PeekBuffer {
+	this := peekBufferPool.Get().(*PeekBuffer)
+	this.Reset(reader)
+	return this
+}
+
+// PutPeekBuffer returns a PeekBuffer to the pool used by GetPeekBuffer.
+// Its buffered data is discarded, its configuration is restored to the defaults and its references to the
+// underlying reader, tee and capture writers and fill hook are cleared so they can be garbage collected.
+// The PeekBuffer, and any slice returned by it, must not be used after it is put back.
+//
+// Parameters:
+//   - pb *PeekBuffer: The PeekBuffer to recycle. It need not have come from GetPeekBuffer.
+func PutPeekBuffer(pb *PeekBuffer) {
+	pb.Reset(nil)
+	pb.fillSize = FillPeekBufferSize
+	pb.capacity = 0
+	pb.maxSize = 0
+	pb.strictEOF = false
+	pb.greedyRead = false
+	pb.shrinkBelow = 0
+	pb.historySize = 0
+	pb.growthFactor = 0
+	pb.recording = false
+	pb.tee = nil
+	pb.capture = nil
+	pb.onFill = nil
+	if len(pb.buffer) > maxPooledBufferSize {
+		pb.buffer = nil
+	}
+	peekBufferPool.Put(pb)
+}
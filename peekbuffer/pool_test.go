@@ -0,0 +1,56 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestGetPeekBuffer(t *testing.T) {
+	pb := GetPeekBuffer(bytes.NewReader([]byte("hello world")))
+	pb.SetMaxBuffer(8)
+	pb.SetTee(io.Discard)
+	pb.SetOnFill(func(int, error) {})
+	if got, err := pb.Peek(5); err != nil || string(got) != "hello" {
+		t.Fatalf("Peek() got = %q, err %v", got, err)
+	}
+	pb.Mark()
+	PutPeekBuffer(pb)
+
+	if pb.reader != nil || pb.tee != nil || pb.onFill != nil {
+		t.Error("PutPeekBuffer() kept a reference to the reader, tee or fill hook")
+	}
+	if pb.Buffered() != 0 || pb.maxSize != 0 || pb.fillSize != FillPeekBufferSize || pb.marked {
+		t.Errorf("PutPeekBuffer() left state behind: %v", pb)
+	}
+
+	pb = GetPeekBuffer(bytes.NewReader([]byte("second stream")))
+	got, err := io.ReadAll(pb)
+	if err != nil || string(got) != "second stream" {
+		t.Errorf("ReadAll() got = %q, err %v", got, err)
+	}
+	PutPeekBuffer(pb)
+}
+
+func TestPutPeekBuffer_DropsLargeBuffer(t *testing.T) {
+	pb := GetPeekBuffer(bytes.NewReader(make([]byte, 2*maxPooledBufferSize)))
+	if _, err := pb.Peek(2 * maxPooledBufferSize); err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	PutPeekBuffer(pb)
+	if pb.buffer != nil {
+		t.Errorf("PutPeekBuffer() kept a %d byte buffer", len(pb.buffer))
+	}
+}
+
+func BenchmarkGetPeekBuffer(b *testing.B) {
+	input := []byte("GET / HTTP/1.1\r\n\r\n")
+	reader := bytes.NewReader(input)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(input)
+		pb := GetPeekBuffer(reader)
+		pb.Peek(4)
+		PutPeekBuffer(pb)
+	}
+}
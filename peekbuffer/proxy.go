@@ -0,0 +1,130 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxyHeaderMaxLen is the maximum length of a PROXY protocol v1 header, including the trailing CRLF.
+const proxyHeaderMaxLen = 107
+
+var proxyHeaderSignature = []byte("PROXY ")
+
+// ErrNoProxyHeader is returned when the stream does not start with a PROXY protocol header.
+var ErrNoProxyHeader = errors.New("peekbuffer: no PROXY protocol header")
+
+// ErrInvalidProxyHeader is returned when the stream starts with a malformed PROXY protocol header.
+var ErrInvalidProxyHeader = errors.New("peekbuffer: invalid PROXY protocol header")
+
+// ProxyHeader is a parsed PROXY protocol v1 header, as prepended to a connection by a reverse proxy.
+type ProxyHeader struct {
+	// Protocol is "TCP4", "TCP6" or "UNKNOWN".
+	Protocol string
+	// Source is the address of the client that connected to the proxy, or nil if Protocol is "UNKNOWN".
+	Source *net.TCPAddr
+	// Destination is the address the client connected to, or nil if Protocol is "UNKNOWN".
+	Destination *net.TCPAddr
+	// Length is the length of the header in bytes, including the trailing CRLF.
+	Length int
+}
+
+// PeekProxyHeader parses a PROXY protocol v1 header at the start of the stream without consuming it.
+// Only the header itself is buffered, so this never waits for data that follows the header.
+// When no header is present the stream is left fully replayable.
+//
+// Returns:
+//   - *ProxyHeader: The parsed header, or nil if an error is returned.
+//   - error: ErrNoProxyHeader if the stream does not start with "PROXY ", ErrInvalidProxyHeader if the header is
+//     malformed or truncated, ErrBufferFull if the maximum buffer size is too small to hold the header,
+//     or any other error encountered while peeking.
+func (this *PeekBuffer) PeekProxyHeader() (*ProxyHeader, error) {
+	if ok, err := this.HasPrefix(proxyHeaderSignature); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNoProxyHeader
+	}
+
+	for {
+		buffered := this.buffer[this.head:this.tail]
+		if len(buffered) > proxyHeaderMaxLen {
+			buffered = buffered[:proxyHeaderMaxLen]
+		}
+		if i := bytes.IndexByte(buffered, '\n'); i >= 0 {
+			return parseProxyHeader(buffered[:i+1])
+		}
+		if len(buffered) == proxyHeaderMaxLen {
+			return nil, ErrInvalidProxyHeader
+		}
+		if err := this.fillMore(); err != nil {
+			if err == io.EOF {
+				return nil, ErrInvalidProxyHeader
+			}
+			return nil, err
+		}
+	}
+}
+
+// ConsumeProxyHeader parses a PROXY protocol v1 header at the start of the stream and consumes it,
+// so that subsequent reads return the proxied stream. Nothing is consumed if an error is returned.
+//
+// Returns:
+//   - *ProxyHeader: The parsed header, or nil if an error is returned.
+//   - error: Any error returned by PeekProxyHeader.
+func (this *PeekBuffer) ConsumeProxyHeader() (*ProxyHeader, error) {
+	header, err := this.PeekProxyHeader()
+	if err != nil {
+		return nil, err
+	}
+	this.advance(header.Length)
+	return header, nil
+}
+
+// parseProxyHeader parses a complete PROXY protocol v1 header line, including the trailing newline.
+func parseProxyHeader(line []byte) (*ProxyHeader, error) {
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+
+	header := &ProxyHeader{Protocol: fields[1], Length: len(line)}
+	switch header.Protocol {
+	case "UNKNOWN":
+		// The rest of the line is ignored
+		return header, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+	if len(fields) != 6 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	var err error
+	if header.Source, err = parseProxyAddr(header.Protocol, fields[2], fields[4]); err != nil {
+		return nil, err
+	}
+	if header.Destination, err = parseProxyAddr(header.Protocol, fields[3], fields[5]); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// parseProxyAddr parses an address and port from a PROXY protocol v1 header.
+func parseProxyAddr(protocol, addr, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil || strings.Contains(addr, ":") != (protocol == "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+	if len(port) > 1 && port[0] == '0' {
+		return nil, ErrInvalidProxyHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
@@ -0,0 +1,117 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestPeekBuffer_PeekProxyHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		protocol string
+		source   string
+		dest     string
+		length   int
+		wantErr  error
+	}{
+		{"TCP4", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET /", "TCP4", "192.168.0.1:56324", "192.168.0.11:443", 47, nil},
+		{"TCP6", "PROXY TCP6 2001:db8::1 2001:db8::2 1 65535\r\n", "TCP6", "[2001:db8::1]:1", "[2001:db8::2]:65535", 44, nil},
+		{"TCP6 mapped", "PROXY TCP6 ::ffff:10.0.0.1 ::1 80 80\r\n", "TCP6", "10.0.0.1:80", "[::1]:80", 38, nil},
+		{"UNKNOWN", "PROXY UNKNOWN\r\ndata", "UNKNOWN", "", "", 15, nil},
+		{"UNKNOWN with addresses", "PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n", "UNKNOWN", "", "", 59, nil},
+		{"Not present", "GET / HTTP/1.1\r\n", "", "", "", 0, ErrNoProxyHeader},
+		{"Too short", "PRO", "", "", "", 0, ErrNoProxyHeader},
+		{"Empty", "", "", "", "", 0, ErrNoProxyHeader},
+		{"Missing CR", "PROXY TCP4 1.2.3.4 5.6.7.8 1 2\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Truncated", "PROXY TCP4 1.2.3.4 5.6.7.8 1", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Too long", "PROXY UNKNOWN " + strings.Repeat("x", 100) + "\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Bad protocol", "PROXY UDP4 1.2.3.4 5.6.7.8 1 2\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Missing port", "PROXY TCP4 1.2.3.4 5.6.7.8 1\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Bad address", "PROXY TCP4 1.2.3 5.6.7.8 1 2\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Family mismatch", "PROXY TCP4 ::1 ::1 1 2\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Port out of range", "PROXY TCP4 1.2.3.4 5.6.7.8 65536 2\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+		{"Port leading zero", "PROXY TCP4 1.2.3.4 5.6.7.8 080 2\r\n", "", "", "", 0, ErrInvalidProxyHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader([]byte(tt.input)))
+			got, err := pb.PeekProxyHeader()
+			if err != tt.wantErr {
+				t.Fatalf("PeekProxyHeader() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if got.Protocol != tt.protocol || got.Length != tt.length {
+					t.Errorf("PeekProxyHeader() got = %q length %d, want %q length %d", got.Protocol, got.Length, tt.protocol, tt.length)
+				}
+				if tt.source == "" {
+					if got.Source != nil || got.Destination != nil {
+						t.Errorf("PeekProxyHeader() got addresses %v %v, want nil", got.Source, got.Destination)
+					}
+				} else if got.Source.String() != tt.source || got.Destination.String() != tt.dest {
+					t.Errorf("PeekProxyHeader() got = %v %v, want %s %s", got.Source, got.Destination, tt.source, tt.dest)
+				}
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || string(remaining) != tt.input {
+				t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, tt.input)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_PeekProxyHeaderBufferFull(t *testing.T) {
+	input := "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+	pb := New(bytes.NewReader([]byte(input)), WithMaxBuffer(16))
+	// A maximum buffer size too small for the header is not a malformed header
+	if _, err := pb.PeekProxyHeader(); err != ErrBufferFull {
+		t.Errorf("PeekProxyHeader() error = %v, want %v", err, ErrBufferFull)
+	}
+	if remaining, err := io.ReadAll(pb); err != nil || string(remaining) != input {
+		t.Errorf("ReadAll() got = %q, err %v, want %q", string(remaining), err, input)
+	}
+}
+
+func TestPeekBuffer_ConsumeProxyHeader(t *testing.T) {
+	input := "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET / HTTP/1.1\r\n"
+	pb := NewPeekBuffer(bytes.NewReader([]byte(input)))
+	header, err := pb.ConsumeProxyHeader()
+	if err != nil || header.Source.Port != 56324 {
+		t.Fatalf("ConsumeProxyHeader() got = %v, err %v", header, err)
+	}
+	if pb.Offset() != int64(header.Length) {
+		t.Errorf("Offset() got = %d, want %d", pb.Offset(), header.Length)
+	}
+	remaining, err := io.ReadAll(pb)
+	if err != nil || string(remaining) != "GET / HTTP/1.1\r\n" {
+		t.Errorf("ReadAll() got = %q, err %v", string(remaining), err)
+	}
+
+	// Nothing is consumed without a header
+	pb = NewPeekBuffer(bytes.NewReader([]byte("GET /")))
+	if _, err := pb.ConsumeProxyHeader(); err != ErrNoProxyHeader {
+		t.Errorf("ConsumeProxyHeader() error = %v, want %v", err, ErrNoProxyHeader)
+	}
+	if pb.Offset() != 0 {
+		t.Errorf("Offset() got = %d, want 0", pb.Offset())
+	}
+}
+
+func TestPeekBuffer_PeekProxyHeaderDoesNotOverRead(t *testing.T) {
+	// The client waits for the server after sending the header, so peeking must not block for more data
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go client.Write([]byte("PROXY UNKNOWN\r\n"))
+
+	pb := NewPeekBuffer(server)
+	header, err := pb.ConsumeProxyHeader()
+	if err != nil || header.Protocol != "UNKNOWN" {
+		t.Fatalf("ConsumeProxyHeader() got = %v, err %v", header, err)
+	}
+}
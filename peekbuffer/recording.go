@@ -0,0 +1,42 @@
+package peekbuffer
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotRecording is returned by RewindAll when the PeekBuffer is not recording.
+var ErrNotRecording = errors.New("peekbuffer: not recording")
+
+// NewRecordingPeekBuffer creates a PeekBuffer that retains every byte it consumes, so RewindAll can replay
+// the stream from the very beginning. This is meant for debugging, such as reproducing a parser bug from a
+// captured stream: memory grows with the total number of bytes read, and the retained bytes do not count
+// towards the maximum buffer size. Reset and Seek restart the recording at the new position.
+//
+// Parameters:
+//   - reader io.Reader: The underlying reader to wrap.
+//
+// Returns:
+//   - *PeekBuffer: A new recording PeekBuffer instance.
+func NewRecordingPeekBuffer(reader io.Reader) *PeekBuffer {
+	this := NewPeekBuffer(reader)
+	this.recording = true
+	return this
+}
+
+// RewindAll returns to the start of the recording, so every byte consumed so far is read again.
+// Unlike Rewind, the recording continues, so the stream can be replayed any number of times.
+// Offset moves back to where the recording started, which is zero unless Seek was called.
+// Bytes pushed back by Unread take the place of the bytes they replace in the recording.
+//
+// Returns:
+//   - error: ErrNotRecording if the PeekBuffer was not created by NewRecordingPeekBuffer, otherwise nil.
+func (this *PeekBuffer) RewindAll() error {
+	if !this.recording {
+		return ErrNotRecording
+	}
+	this.offset -= int64(this.head - this.origin)
+	this.head = this.origin
+	this.unread = false
+	return nil
+}
@@ -0,0 +1,121 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPeekBuffer_RewindAll(t *testing.T) {
+	input := benchmarkInput()[:20000]
+
+	tests := []struct {
+		name string
+		read func(pb *PeekBuffer) error
+	}{
+		{"Read", func(pb *PeekBuffer) error {
+			_, err := io.ReadFull(pb, make([]byte, 15000))
+			return err
+		}},
+		{"ReadByte", func(pb *PeekBuffer) error {
+			for i := 0; i < 9000; i++ {
+				if _, err := pb.ReadByte(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"Discard", func(pb *PeekBuffer) error {
+			_, err := pb.Discard(12000)
+			return err
+		}},
+		{"Mark and rewind", func(pb *PeekBuffer) error {
+			pb.Discard(100)
+			pb.Mark()
+			pb.Discard(5000)
+			return pb.Rewind()
+		}},
+		{"Unread", func(pb *PeekBuffer) error {
+			pb.Discard(5000)
+			return pb.Unread(input[4900:5000])
+		}},
+		{"Read all", func(pb *PeekBuffer) error {
+			_, err := io.ReadAll(pb)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewRecordingPeekBuffer(bytes.NewReader(input))
+			pb.SetMaxBuffer(1000)
+			if err := tt.read(pb); err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if err := pb.RewindAll(); err != nil {
+				t.Fatalf("RewindAll() error = %v", err)
+			}
+			if got := pb.Offset(); got != 0 {
+				t.Errorf("Offset() after RewindAll got = %v, want 0", got)
+			}
+
+			// The recording continues, so the stream can be replayed again
+			if _, err := pb.Discard(500); err != nil {
+				t.Fatalf("Discard() error = %v", err)
+			}
+			if err := pb.RewindAll(); err != nil {
+				t.Fatalf("RewindAll() error = %v", err)
+			}
+			got, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(got, input) {
+				t.Errorf("ReadAll() after RewindAll got %d bytes, err %v, want %d", len(got), err, len(input))
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_RewindAllRestart(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if err := pb.RewindAll(); err != ErrNotRecording {
+		t.Errorf("RewindAll() without recording error = %v, want %v", err, ErrNotRecording)
+	}
+
+	pb = NewRecordingPeekBuffer(bytes.NewReader([]byte("hello world")))
+	pb.Discard(3)
+	if _, err := pb.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	pb.Discard(2)
+	if err := pb.RewindAll(); err != nil || pb.Offset() != 6 {
+		t.Errorf("RewindAll() after Seek err %v, offset %v, want offset 6", err, pb.Offset())
+	}
+	if got, _ := io.ReadAll(pb); string(got) != "world" {
+		t.Errorf("ReadAll() after Seek and RewindAll got = %q, want %q", got, "world")
+	}
+
+	pb.Reset(bytes.NewReader([]byte("again")))
+	pb.Discard(3)
+	if err := pb.RewindAll(); err != nil {
+		t.Fatalf("RewindAll() after Reset error = %v", err)
+	}
+	if got, _ := io.ReadAll(pb); string(got) != "again" {
+		t.Errorf("ReadAll() after Reset and RewindAll got = %q, want %q", got, "again")
+	}
+}
+
+func TestPeekBuffer_RewindAllUnread(t *testing.T) {
+	pb := NewRecordingPeekBuffer(bytes.NewReader([]byte("abcdefgh")))
+	pb.Discard(4)
+	if err := pb.Unread([]byte("cd")); err != nil {
+		t.Fatalf("Unread() error = %v", err)
+	}
+	if err := pb.RewindAll(); err != nil {
+		t.Fatalf("RewindAll() error = %v", err)
+	}
+	if got := pb.Offset(); got != 0 {
+		t.Errorf("Offset() after RewindAll got = %d, want 0", got)
+	}
+	if got, err := io.ReadAll(pb); err != nil || string(got) != "abcdefgh" {
+		t.Errorf("ReadAll() after RewindAll got = %q, err %v, want %q", got, err, "abcdefgh")
+	}
+}
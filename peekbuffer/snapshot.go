@@ -0,0 +1,93 @@
+package peekbuffer
+
+import (
+	"errors"
+)
+
+// ErrInvalidSnapshot is returned by Restore when the snapshot was already restored or released,
+// or was taken before the last Reset.
+var ErrInvalidSnapshot = errors.New("peekbuffer: invalid snapshot")
+
+// Snapshot is a position in the stream captured by PeekBuffer.Snapshot.
+type Snapshot struct {
+	id     uint64
+	offset int64
+}
+
+// Offset returns the stream offset at which the snapshot was taken.
+//
+// Returns:
+//   - int64: The number of bytes that had been consumed when the snapshot was taken.
+func (this Snapshot) Offset() int64 {
+	return this.offset
+}
+
+// snapshotPin is the PeekBuffer side of an active Snapshot.
+type snapshotPin struct {
+	id     uint64
+	index  int // index in buffer of the snapshot position
+	offset int64
+}
+
+// Snapshot captures the current read position so that Restore can roll back to it later.
+// Unlike Mark, any number of snapshots can be active at once, which suits speculative parsers that try one
+// parse path and abandon it for another, possibly nested.
+// A snapshot pins every byte consumed after it in memory until it is restored or released,
+// and like Mark those retained bytes do not count towards the maximum buffer size.
+// Only the position is captured: bytes that were consumed before the snapshot was taken can never be restored.
+//
+// Returns:
+//   - Snapshot: A handle to pass to Restore or Release.
+func (this *PeekBuffer) Snapshot() Snapshot {
+	this.lastSnapshot++
+	this.snapshots = append(this.snapshots, snapshotPin{id: this.lastSnapshot, index: this.head, offset: this.offset})
+	return Snapshot{id: this.lastSnapshot, offset: this.offset}
+}
+
+// Restore rolls the stream back to the position captured by s, so every byte consumed since then is read again.
+// The snapshot is released by restoring it; other active snapshots remain valid.
+//
+// Parameters:
+//   - s Snapshot: A snapshot returned by Snapshot.
+//
+// Returns:
+//   - error: ErrInvalidSnapshot if s is not active, otherwise nil.
+func (this *PeekBuffer) Restore(s Snapshot) error {
+	i := this.findSnapshot(s)
+	if i < 0 {
+		return ErrInvalidSnapshot
+	}
+	pin := this.snapshots[i]
+	this.removeSnapshot(i)
+	this.head = pin.index
+	this.offset = pin.offset
+	this.unread = false
+	return nil
+}
+
+// Release discards s without restoring it, so the bytes it pinned can be freed.
+// Releasing a snapshot that is not active does nothing.
+//
+// Parameters:
+//   - s Snapshot: A snapshot returned by Snapshot.
+func (this *PeekBuffer) Release(s Snapshot) {
+	if i := this.findSnapshot(s); i >= 0 {
+		this.removeSnapshot(i)
+	}
+}
+
+// findSnapshot returns the index in snapshots of the pin for s, or -1 if s is not active.
+func (this *PeekBuffer) findSnapshot(s Snapshot) int {
+	for i, pin := range this.snapshots {
+		if pin.id == s.id {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeSnapshot removes the pin at index i of snapshots.
+func (this *PeekBuffer) removeSnapshot(i int) {
+	copy(this.snapshots[i:], this.snapshots[i+1:])
+	this.snapshots = this.snapshots[:len(this.snapshots)-1]
+}
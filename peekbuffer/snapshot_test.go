@@ -0,0 +1,215 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPeekBuffer_SnapshotRestore(t *testing.T) {
+	input := benchmarkInput()[:20000]
+
+	tests := []struct {
+		name string
+		peek int
+		skip int
+		read func(pb *PeekBuffer) error
+	}{
+		{"Read from buffer", 100, 10, func(pb *PeekBuffer) error {
+			_, err := io.ReadFull(pb, make([]byte, 50))
+			return err
+		}},
+		{"Read from reader", 0, 10, func(pb *PeekBuffer) error {
+			_, err := io.ReadFull(pb, make([]byte, 15000))
+			return err
+		}},
+		{"ReadByte", 0, 10, func(pb *PeekBuffer) error {
+			for i := 0; i < 9000; i++ {
+				if _, err := pb.ReadByte(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"Discard", 0, 10, func(pb *PeekBuffer) error {
+			_, err := pb.Discard(12000)
+			return err
+		}},
+		{"Mark and rewind", 0, 10, func(pb *PeekBuffer) error {
+			pb.Discard(100)
+			pb.Mark()
+			pb.Discard(5000)
+			return pb.Rewind()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+			if _, err := pb.Peek(tt.peek); err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+			if _, err := pb.Discard(tt.skip); err != nil {
+				t.Fatalf("Discard() error = %v", err)
+			}
+
+			s := pb.Snapshot()
+			if got := s.Offset(); got != int64(tt.skip) {
+				t.Errorf("Snapshot().Offset() got = %v, want %v", got, tt.skip)
+			}
+			if err := tt.read(pb); err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if err := pb.Restore(s); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			if got := pb.Offset(); got != int64(tt.skip) {
+				t.Errorf("Offset() after Restore got = %v, want %v", got, tt.skip)
+			}
+
+			got, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(got, input[tt.skip:]) {
+				t.Errorf("ReadAll() after Restore got %d bytes, err %v, want %d bytes", len(got), err, len(input)-tt.skip)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_SnapshotNested(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("hello world")), 2)
+	outer := pb.Snapshot()
+	pb.Discard(3)
+	inner := pb.Snapshot()
+	pb.Discard(5)
+
+	if err := pb.Restore(inner); err != nil {
+		t.Fatalf("Restore(inner) error = %v", err)
+	}
+	if got, _ := pb.Peek(3); string(got) != "lo " {
+		t.Errorf("Peek() after Restore(inner) got = %q, want %q", got, "lo ")
+	}
+	pb.Discard(6)
+	if err := pb.Restore(outer); err != nil {
+		t.Fatalf("Restore(outer) error = %v", err)
+	}
+	if got, err := io.ReadAll(pb); err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() after Restore(outer) got = %q, err %v", got, err)
+	}
+}
+
+func TestPeekBuffer_SnapshotUnread(t *testing.T) {
+	const input = "0123456789"
+
+	tests := []struct {
+		name   string
+		unread func(pb *PeekBuffer, earlier Snapshot)
+		offset int64
+		want   string
+	}{
+		{"Later snapshot after UnreadByte", func(pb *PeekBuffer, earlier Snapshot) {
+			pb.Restore(earlier)
+			pb.ReadByte()
+			pb.UnreadByte()
+		}, 5, "56789"},
+		{"Later snapshot after Unread", func(pb *PeekBuffer, earlier Snapshot) {
+			pb.Restore(earlier)
+			pb.Discard(3)
+			pb.Unread([]byte("12"))
+		}, 5, "56789"},
+		{"Snapshot within the unread bytes", func(pb *PeekBuffer, earlier Snapshot) {
+			pb.Unread([]byte("34"))
+		}, 3, "3456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBufferSize(bytes.NewReader([]byte(input)), 4)
+			earlier := pb.Snapshot()
+			pb.Discard(5)
+			later := pb.Snapshot()
+			tt.unread(pb, earlier)
+
+			if err := pb.Restore(later); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			if got := pb.Offset(); got != tt.offset {
+				t.Errorf("Offset() after Restore got = %d, want %d", got, tt.offset)
+			}
+			if got, err := io.ReadAll(pb); err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() after Restore got = %q, err %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBuffer_SnapshotUnreadDrained(t *testing.T) {
+	input := benchmarkInput()[:20]
+	pb := NewPeekBufferSize(bytes.NewReader(input), 10)
+	pb.Discard(10)
+	s := pb.Snapshot()
+	// The buffer is drained, so pushing back reallocates it
+	if err := pb.Unread(input[7:10]); err != nil {
+		t.Fatalf("Unread() error = %v", err)
+	}
+	if err := pb.Restore(s); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got := pb.Offset(); got != 7 {
+		t.Errorf("Offset() after Restore got = %d, want 7", got)
+	}
+	if got, err := io.ReadAll(pb); err != nil || !bytes.Equal(got, input[7:]) {
+		t.Errorf("ReadAll() after Restore got = %v, err %v, want %v", got, err, input[7:])
+	}
+}
+
+func TestPeekBuffer_SnapshotInvalid(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	if err := pb.Restore(Snapshot{}); err != ErrInvalidSnapshot {
+		t.Errorf("Restore(Snapshot{}) error = %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	s := pb.Snapshot()
+	pb.Discard(2)
+	if err := pb.Restore(s); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if err := pb.Restore(s); err != ErrInvalidSnapshot {
+		t.Errorf("Restore() twice error = %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	s = pb.Snapshot()
+	pb.Release(s)
+	pb.Release(s)
+	if err := pb.Restore(s); err != ErrInvalidSnapshot {
+		t.Errorf("Restore() after Release error = %v, want %v", err, ErrInvalidSnapshot)
+	}
+
+	s = pb.Snapshot()
+	pb.Reset(bytes.NewReader([]byte("other")))
+	if err := pb.Restore(s); err != ErrInvalidSnapshot {
+		t.Errorf("Restore() after Reset error = %v, want %v", err, ErrInvalidSnapshot)
+	}
+}
+
+func TestPeekBuffer_SnapshotRelease(t *testing.T) {
+	input := benchmarkInput()[:100000]
+	pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+	s := pb.Snapshot()
+	if _, err := pb.Discard(50000); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if len(pb.buffer) < 50000 {
+		t.Errorf("buffer size got = %v, want at least 50000 while the snapshot is active", len(pb.buffer))
+	}
+
+	pb.Release(s)
+	if _, err := pb.Discard(1000); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if len(pb.buffer) > 50000 {
+		t.Errorf("buffer size got = %v, want the retained bytes released", len(pb.buffer))
+	}
+	if got, err := io.ReadAll(pb); err != nil || !bytes.Equal(got, input[51000:]) {
+		t.Errorf("ReadAll() got %d bytes, err %v", len(got), err)
+	}
+}
@@ -0,0 +1,54 @@
+package peekbuffer
+
+// Stats reports how a PeekBuffer has used its underlying reader and internal buffer since it was created or
+// last Reset. It is intended for tuning the fill size and maximum buffer size from real traffic.
+type Stats struct {
+	// FillCount is the number of reads from the underlying reader into the internal buffer.
+	FillCount int64
+	// BytesRead is the number of bytes read from the underlying reader, whether into the internal buffer
+	// or directly by Read and Discard.
+	BytesRead int64
+	// BytesPeeked is the total length of the data returned by Peek and the other peek methods.
+	BytesPeeked int64
+	// MaxBuffered is the largest number of bytes that were buffered at once.
+	MaxBuffered int
+}
+
+// Stats returns the usage statistics of the PeekBuffer.
+// Like the rest of PeekBuffer the statistics are not synchronized: they are updated without locks or atomics,
+// so Stats must not be called concurrently with other methods. Use SyncPeekBuffer when sharing a PeekBuffer.
+//
+// Returns:
+//   - Stats: A copy of the statistics.
+func (this *PeekBuffer) Stats() Stats {
+	return this.stats
+}
+
+// SetOnFill sets a hook that is called after each read from the underlying reader into the internal buffer,
+// with the number of bytes obtained and the error returned by the read. It observes exactly when and how much
+// the PeekBuffer pulls from the underlying reader, for tracing, without wrapping the reader.
+// Reads that bypass the internal buffer, such as a large Read with nothing buffered, are not reported.
+// The hook is called synchronously and must not call methods of the PeekBuffer.
+//
+// Parameters:
+//   - onFill func(n int, err error): The hook, or nil to remove it.
+func (this *PeekBuffer) SetOnFill(onFill func(n int, err error)) {
+	this.onFill = onFill
+}
+
+// filled records a read of n bytes from the underlying reader into the internal buffer.
+func (this *PeekBuffer) filled(n int, err error) {
+	this.stats.FillCount++
+	this.stats.BytesRead += int64(n)
+	this.grew()
+	if this.onFill != nil {
+		this.onFill(n, err)
+	}
+}
+
+// grew records the number of buffered bytes after data was added to the internal buffer.
+func (this *PeekBuffer) grew() {
+	if buffered := this.Buffered(); buffered > this.stats.MaxBuffered {
+		this.stats.MaxBuffered = buffered
+	}
+}
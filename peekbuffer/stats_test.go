@@ -0,0 +1,75 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestPeekBuffer_Stats(t *testing.T) {
+	input := benchmarkInput()[:10000]
+	pb := NewPeekBufferSize(bytes.NewReader(input), 1000)
+	if got := pb.Stats(); got != (Stats{}) {
+		t.Errorf("Stats() before use got = %+v, want zero", got)
+	}
+
+	pb.Peek(10)
+	pb.Peek(1500)
+	pb.ReadByte()
+	want := Stats{FillCount: 2, BytesRead: 2000, BytesPeeked: 1510, MaxBuffered: 2000}
+	if got := pb.Stats(); got != want {
+		t.Errorf("Stats() after Peek got = %+v, want %+v", got, want)
+	}
+
+	// Reads that bypass the buffer count as read but not as fills
+	io.ReadAll(pb)
+	got := pb.Stats()
+	if got.BytesRead != int64(len(input)) || got.FillCount != 2 || got.MaxBuffered != 2000 {
+		t.Errorf("Stats() after ReadAll got = %+v, want %d bytes read", got, len(input))
+	}
+
+	pb.Reset(bytes.NewReader(input))
+	if got := pb.Stats(); got != (Stats{}) {
+		t.Errorf("Stats() after Reset got = %+v, want zero", got)
+	}
+}
+
+func TestPeekBuffer_StatsDiscard(t *testing.T) {
+	pb := NewPeekBufferSize(bytes.NewReader(benchmarkInput()[:10000]), 1000)
+	pb.Peek(1)
+	pb.Discard(5000)
+	want := Stats{FillCount: 1, BytesRead: 5000, BytesPeeked: 1, MaxBuffered: 1000}
+	if got := pb.Stats(); got != want {
+		t.Errorf("Stats() after Discard got = %+v, want %+v", got, want)
+	}
+}
+
+func TestPeekBuffer_SetOnFill(t *testing.T) {
+	type fill struct {
+		n   int
+		err error
+	}
+	var fills []fill
+	pb := NewPeekBufferSize(bytes.NewReader([]byte("hello world")), 8)
+	pb.SetOnFill(func(n int, err error) {
+		fills = append(fills, fill{n, err})
+	})
+
+	pb.Peek(4)
+	pb.Peek(20)
+	want := []fill{{8, nil}, {3, nil}, {0, io.EOF}}
+	if !reflect.DeepEqual(fills, want) {
+		t.Errorf("SetOnFill() hook got %v, want %v", fills, want)
+	}
+
+	fills = nil
+	pb.SetOnFill(nil)
+	pb.Peek(40)
+	if len(fills) != 0 {
+		t.Errorf("SetOnFill(nil) hook still called: %v", fills)
+	}
+	if got, err := io.ReadAll(pb); err != nil || string(got) != "hello world" {
+		t.Errorf("ReadAll() got = %q, err %v", got, err)
+	}
+}
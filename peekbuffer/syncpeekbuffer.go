@@ -0,0 +1,57 @@
+package peekbuffer
+
+import "sync"
+
+// SyncPeekBuffer wraps a PeekBuffer and serializes Read, ReadByte, Peek and PeekByte with a mutex,
+// so a single stream can be shared between goroutines without data races on the internal buffer.
+//
+// Locking only protects the PeekBuffer's own state. A slice returned by Peek is still a view into the
+// internal buffer and is only valid until the next call on the SyncPeekBuffer from any goroutine, so
+// callers that need the data to outlive their own critical section must copy it.
+type SyncPeekBuffer struct {
+	mutex  sync.Mutex
+	buffer *PeekBuffer
+}
+
+// NewSyncPeekBuffer creates and returns a new SyncPeekBuffer that guards the provided PeekBuffer.
+// The PeekBuffer must not be used directly after it has been wrapped.
+//
+// Parameters:
+//   - buffer *PeekBuffer: The PeekBuffer to guard.
+//
+// Returns:
+//   - *SyncPeekBuffer: A new SyncPeekBuffer instance.
+func NewSyncPeekBuffer(buffer *PeekBuffer) *SyncPeekBuffer {
+	return &SyncPeekBuffer{
+		buffer: buffer,
+	}
+}
+
+// Read implements the io.Reader interface while holding the lock. See PeekBuffer.Read.
+func (this *SyncPeekBuffer) Read(p []byte) (n int, err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buffer.Read(p)
+}
+
+// ReadByte implements the io.ByteReader interface while holding the lock. See PeekBuffer.ReadByte.
+func (this *SyncPeekBuffer) ReadByte() (byte, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buffer.ReadByte()
+}
+
+// Peek looks ahead in the stream while holding the lock. See PeekBuffer.Peek.
+// The returned slice is only valid until the next call on the SyncPeekBuffer from any goroutine.
+func (this *SyncPeekBuffer) Peek(size int) ([]byte, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buffer.Peek(size)
+}
+
+// PeekByte looks ahead in the stream at a specific offset while holding the lock. See PeekBuffer.PeekByte.
+func (this *SyncPeekBuffer) PeekByte(offset int) (byte, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.buffer.PeekByte(offset)
+}
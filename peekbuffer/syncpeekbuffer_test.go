@@ -0,0 +1,53 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestSyncPeekBuffer_Concurrent(t *testing.T) {
+	input := make([]byte, 1<<16)
+	for i := range input {
+		input[i] = byte(i % 256)
+	}
+
+	spb := NewSyncPeekBuffer(NewPeekBufferSize(bytes.NewReader(input), 64))
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	total := 0
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 7)
+			for {
+				if _, err := spb.Peek(16); err != nil {
+					t.Errorf("Peek() error = %v", err)
+					return
+				}
+				if _, err := spb.PeekByte(3); err != nil && err != io.EOF {
+					t.Errorf("PeekByte() error = %v", err)
+					return
+				}
+				n, err := spb.Read(buf)
+				if n == 0 {
+					if _, err = spb.ReadByte(); err != io.EOF {
+						t.Errorf("ReadByte() error = %v, want %v", err, io.EOF)
+					}
+					return
+				}
+				mutex.Lock()
+				total += n
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if total != len(input) {
+		t.Errorf("goroutines read %d bytes, want %d", total, len(input))
+	}
+}
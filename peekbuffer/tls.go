@@ -0,0 +1,172 @@
+package peekbuffer
+
+import (
+	"errors"
+)
+
+const (
+	tlsRecordHeaderLen     = 5
+	tlsRecordMaxLen        = 1 << 14
+	tlsRecordTypeHandshake = 0x16
+	tlsHandshakeHeaderLen  = 4
+	tlsTypeClientHello     = 0x01
+	tlsExtensionServerName = 0x0000
+	tlsServerNameHostName  = 0x00
+
+	// tlsClientHelloMaxLen bounds how much is buffered for a single ClientHello. Real ClientHellos are a few
+	// kilobytes at most, this stops a hostile length field from buffering up to 16MiB.
+	tlsClientHelloMaxLen = 1 << 16
+)
+
+// ErrNotClientHello is returned by PeekTLSServerName when the stream does not start with a TLS ClientHello.
+var ErrNotClientHello = errors.New("peekbuffer: not a TLS ClientHello")
+
+// ErrNoServerName is returned by PeekTLSServerName when the ClientHello has no server_name extension.
+var ErrNoServerName = errors.New("peekbuffer: TLS ClientHello has no server name")
+
+// PeekTLSServerName parses the TLS ClientHello at the start of the stream and returns the host name from its
+// server_name (SNI) extension, without consuming any data. This allows a connection to be routed by host name
+// and the raw TLS stream then passed on intact.
+// A ClientHello split over several TLS records is reassembled, so the whole handshake message is buffered.
+//
+// Returns:
+//   - string: The requested server name.
+//   - error: ErrNotClientHello if the stream is not a TLS ClientHello, ErrNoServerName if it has no server name,
+//     io.EOF or io.ErrUnexpectedEOF if the stream ends early, or any other error returned by Peek.
+func (this *PeekBuffer) PeekTLSServerName() (string, error) {
+	var handshake []byte
+	offset := 0
+	need := tlsHandshakeHeaderLen
+	for sized := false; len(handshake) < need; {
+		header, err := this.PeekFull(offset + tlsRecordHeaderLen)
+		if err != nil {
+			return "", err
+		}
+		header = header[offset:]
+		length := int(header[3])<<8 | int(header[4])
+		if header[0] != tlsRecordTypeHandshake || header[1] != 3 || length == 0 || length > tlsRecordMaxLen {
+			return "", ErrNotClientHello
+		}
+
+		fragment, err := this.PeekFull(offset + tlsRecordHeaderLen + length)
+		if err != nil {
+			return "", err
+		}
+		handshake = append(handshake, fragment[offset+tlsRecordHeaderLen:]...)
+		offset += tlsRecordHeaderLen + length
+
+		if !sized && len(handshake) >= tlsHandshakeHeaderLen {
+			if handshake[0] != tlsTypeClientHello {
+				return "", ErrNotClientHello
+			}
+			need += int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if need > tlsClientHelloMaxLen {
+				return "", ErrNotClientHello
+			}
+			sized = true
+		}
+	}
+	return parseServerName(handshake[tlsHandshakeHeaderLen:need])
+}
+
+// parseServerName extracts the host name from the server_name extension of a ClientHello message body.
+func parseServerName(hello []byte) (string, error) {
+	r := tlsReader(hello)
+	// Skip the legacy version and random, then the session ID, cipher suites and compression methods
+	if !r.skip(2+32) || !r.skipVector(1) || !r.skipVector(2) || !r.skipVector(1) {
+		return "", ErrNotClientHello
+	}
+	if len(r) == 0 {
+		// Extensions are optional
+		return "", ErrNoServerName
+	}
+
+	extensions, ok := r.vector(2)
+	if !ok {
+		return "", ErrNotClientHello
+	}
+	for len(extensions) > 0 {
+		extType, ok := extensions.uint16()
+		if !ok {
+			return "", ErrNotClientHello
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return "", ErrNotClientHello
+		}
+		if extType != tlsExtensionServerName {
+			continue
+		}
+
+		names, ok := data.vector(2)
+		if !ok {
+			return "", ErrNotClientHello
+		}
+		for len(names) > 0 {
+			nameType, ok := names.uint8()
+			if !ok {
+				return "", ErrNotClientHello
+			}
+			name, ok := names.vector(2)
+			if !ok {
+				return "", ErrNotClientHello
+			}
+			if nameType == tlsServerNameHostName && len(name) > 0 {
+				return string(name), nil
+			}
+		}
+		return "", ErrNoServerName
+	}
+	return "", ErrNoServerName
+}
+
+// tlsReader decodes the big-endian, length-prefixed fields used by TLS handshake messages.
+type tlsReader []byte
+
+func (this *tlsReader) skip(n int) bool {
+	if len(*this) < n {
+		return false
+	}
+	*this = (*this)[n:]
+	return true
+}
+
+func (this *tlsReader) uint8() (int, bool) {
+	if len(*this) < 1 {
+		return 0, false
+	}
+	v := int((*this)[0])
+	*this = (*this)[1:]
+	return v, true
+}
+
+func (this *tlsReader) uint16() (int, bool) {
+	if len(*this) < 2 {
+		return 0, false
+	}
+	v := int((*this)[0])<<8 | int((*this)[1])
+	*this = (*this)[2:]
+	return v, true
+}
+
+// vector returns a field prefixed by a lengthSize byte length.
+func (this *tlsReader) vector(lengthSize int) (tlsReader, bool) {
+	var n int
+	var ok bool
+	if lengthSize == 1 {
+		n, ok = this.uint8()
+	} else {
+		n, ok = this.uint16()
+	}
+	if !ok || len(*this) < n {
+		return nil, false
+	}
+	v := (*this)[:n]
+	*this = (*this)[n:]
+	return v, true
+}
+
+func (this *tlsReader) skipVector(lengthSize int) bool {
+	_, ok := this.vector(lengthSize)
+	return ok
+}
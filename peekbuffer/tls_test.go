@@ -0,0 +1,86 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+)
+
+// clientHello captures the first TLS record sent by a crypto/tls client.
+func clientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+	defer client.Close()
+
+	header := make([]byte, tlsRecordHeaderLen)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	record := make([]byte, tlsRecordHeaderLen+(int(header[3])<<8|int(header[4])))
+	copy(record, header)
+	if _, err := io.ReadFull(server, record[tlsRecordHeaderLen:]); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	return record
+}
+
+// fragmentRecord splits a single TLS record into records carrying at most size bytes each.
+func fragmentRecord(record []byte, size int) []byte {
+	var out []byte
+	payload := record[tlsRecordHeaderLen:]
+	for len(payload) > 0 {
+		n := size
+		if n > len(payload) {
+			n = len(payload)
+		}
+		out = append(out, record[0], record[1], record[2], byte(n>>8), byte(n))
+		out = append(out, payload[:n]...)
+		payload = payload[n:]
+	}
+	return out
+}
+
+func TestPeekBuffer_PeekTLSServerName(t *testing.T) {
+	hello := clientHello(t, "example.com")
+	noSNI := clientHello(t, "")
+
+	tests := []struct {
+		name    string
+		input   []byte
+		want    string
+		wantErr error
+	}{
+		{"ClientHello", hello, "example.com", nil},
+		{"Trailing data", append(append([]byte{}, hello...), "more"...), "example.com", nil},
+		{"Fragmented", fragmentRecord(hello, 100), "example.com", nil},
+		{"Fragmented header", fragmentRecord(hello, 1), "example.com", nil},
+		{"No server name", noSNI, "", ErrNoServerName},
+		{"Plain text", []byte("GET / HTTP/1.1\r\n"), "", ErrNotClientHello},
+		{"Alert record", []byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28}, "", ErrNotClientHello},
+		{"ServerHello", []byte{0x16, 0x03, 0x03, 0x00, 0x04, 0x02, 0x00, 0x00, 0x00}, "", ErrNotClientHello},
+		{"Oversized", []byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0xff, 0xff, 0xff}, "", ErrNotClientHello},
+		{"Truncated body", []byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x02, 0x03}, "", io.ErrUnexpectedEOF},
+		{"Malformed body", []byte{0x16, 0x03, 0x01, 0x00, 0x06, 0x01, 0x00, 0x00, 0x02, 0x03, 0x03}, "", ErrNotClientHello},
+		{"Truncated", hello[:len(hello)/2], "", io.ErrUnexpectedEOF},
+		{"Empty", nil, "", io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPeekBuffer(bytes.NewReader(tt.input))
+			got, err := pb.PeekTLSServerName()
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("PeekTLSServerName() got = %q, err %v, want %q, err %v", got, err, tt.want, tt.wantErr)
+			}
+
+			remaining, err := io.ReadAll(pb)
+			if err != nil || !bytes.Equal(remaining, tt.input) {
+				t.Errorf("ReadAll() got %d bytes, err %v, want %d bytes", len(remaining), err, len(tt.input))
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package peekbuffer
+
+import (
+	"unsafe"
+)
+
+// PeekStringUnsafe is like PeekString but returns a string that shares memory with the internal buffer
+// instead of a copy, so it does not allocate. It is meant for hot parsing loops that only compare or look up
+// the peeked text before reading on.
+//
+// The string is only valid until the next Read operation, or until a later Peek has to buffer more data:
+// after that the bytes it refers to may be overwritten, which breaks the immutability the rest of Go assumes
+// for strings, for example for map keys. The string must not be retained, and the slices returned by Peek
+// must not be modified while it is in use. The backing array is kept alive by the string, so holding on to it
+// is memory safe, but its contents are undefined.
+//
+// Parameters:
+//   - size int: The number of bytes to peek ahead.
+//
+// Returns:
+//   - string: A view of the peeked data. May be shorter than 'size' if the stream has less data than requested.
+//   - error: Any error returned by Peek.
+func (this *PeekBuffer) PeekStringUnsafe(size int) (string, error) {
+	peeked, err := this.Peek(size)
+	if len(peeked) == 0 {
+		return "", err
+	}
+	return unsafe.String(&peeked[0], len(peeked)), err
+}
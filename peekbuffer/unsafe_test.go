@@ -0,0 +1,31 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPeekBuffer_PeekStringUnsafe(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	got, err := pb.PeekStringUnsafe(5)
+	if err != nil || got != "hello" {
+		t.Errorf("PeekStringUnsafe() got = %q, err %v, want %q", got, err, "hello")
+	}
+	if got, err := pb.PeekStringUnsafe(0); err != nil || got != "" {
+		t.Errorf("PeekStringUnsafe(0) got = %q, err %v, want empty", got, err)
+	}
+
+	// The string is a view of the buffer, not a copy
+	peeked, _ := pb.Peek(5)
+	peeked[0] = 'j'
+	if got != "jello" {
+		t.Errorf("PeekStringUnsafe() result got = %q after modifying the buffer, want %q", got, "jello")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		pb.PeekStringUnsafe(5)
+	})
+	if allocs != 0 {
+		t.Errorf("PeekStringUnsafe() allocated %v times per call, want 0", allocs)
+	}
+}
@@ -0,0 +1,34 @@
+package peekbuffer
+
+// PeekWindow is a read-only view of the lookahead of a PeekBuffer, created by PeekBuffer.Window.
+// It can peek but has no methods that consume data, so the lookahead can be handed to a sub-parser
+// without the risk of it advancing the stream.
+//
+// A PeekWindow shares the buffer of its PeekBuffer and its offsets are relative to the current position of
+// the PeekBuffer. Once the PeekBuffer consumes data, the same offset in the window refers to later bytes.
+type PeekWindow struct {
+	buffer *PeekBuffer
+}
+
+// Window returns a read-only view of the lookahead of the PeekBuffer.
+//
+// Returns:
+//   - *PeekWindow: A PeekWindow sharing the buffer of the PeekBuffer.
+func (this *PeekBuffer) Window() *PeekWindow {
+	return &PeekWindow{buffer: this}
+}
+
+// Peek looks ahead in the stream without consuming the data. See PeekBuffer.Peek.
+func (this *PeekWindow) Peek(size int) ([]byte, error) {
+	return this.buffer.Peek(size)
+}
+
+// PeekAt looks ahead at a window deeper in the stream without consuming the data. See PeekBuffer.PeekAt.
+func (this *PeekWindow) PeekAt(offset, size int) ([]byte, error) {
+	return this.buffer.PeekAt(offset, size)
+}
+
+// PeekByte returns the byte at offset without consuming any data. See PeekBuffer.PeekByte.
+func (this *PeekWindow) PeekByte(offset int) (byte, error) {
+	return this.buffer.PeekByte(offset)
+}
@@ -0,0 +1,33 @@
+package peekbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPeekBuffer_Window(t *testing.T) {
+	pb := NewPeekBuffer(bytes.NewReader([]byte("hello world")))
+	window := pb.Window()
+
+	if got, err := window.Peek(5); err != nil || string(got) != "hello" {
+		t.Errorf("Peek() got = %q, err %v, want %q", got, err, "hello")
+	}
+	if got, err := window.PeekAt(6, 5); err != nil || string(got) != "world" {
+		t.Errorf("PeekAt() got = %q, err %v, want %q", got, err, "world")
+	}
+	if got, err := window.PeekByte(4); err != nil || got != 'o' {
+		t.Errorf("PeekByte() got = %q, err %v, want %q", got, err, 'o')
+	}
+	if pb.Offset() != 0 {
+		t.Errorf("PeekWindow consumed %d bytes", pb.Offset())
+	}
+
+	// Offsets in the window follow the position of the PeekBuffer
+	pb.Discard(6)
+	if got, err := window.Peek(5); err != nil || string(got) != "world" {
+		t.Errorf("Peek() after Discard got = %q, err %v, want %q", got, err, "world")
+	}
+	if got, err := window.PeekByte(0); err != nil || got != 'w' {
+		t.Errorf("PeekByte() after Discard got = %q, err %v, want %q", got, err, 'w')
+	}
+}